@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var pullPageID string
+
+func init() {
+	pullCmd.Flags().StringVar(&pullPageID, "page-id", "", "ID of the page to pull (defaults to the last page of --parent)")
+	rootCmd.AddCommand(pullCmd)
+}
+
+// pullCmd converts a page subtree back into markdown files
+var pullCmd = &cobra.Command{
+	Use:   "pull [directory]",
+	Short: "Pull a Confluence page and all pages below it into markdown files",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		directory := "."
+		if len(args) > 0 {
+			directory = args[0]
+		}
+		m.SourceMarkdown = []string{directory}
+
+		err := m.Validate()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		errors := m.Pull(pullPageID, directory)
+
+		if m.DryRun && m.Plan != nil {
+			m.Plan.Print(os.Stdout)
+		}
+
+		for _, err := range errors {
+			fmt.Println()
+			fmt.Println(err)
+		}
+		if len(errors) > 0 {
+			os.Exit(1)
+		}
+	},
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	lib "markdownToConfluence/lib"
+	"markdownToConfluence/lib/renderer"
 
 	"github.com/spf13/cobra"
 )
@@ -21,6 +22,10 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&m.Comment, "comment", "c", "", "(Optional) Add comment to page")
 	rootCmd.PersistentFlags().StringVarP(&m.Username, "username", "u", "", "Confluence username. (Alternatively set CONFLUENCE_USERNAME environment variable)")
 	rootCmd.PersistentFlags().StringVarP(&m.Password, "password", "p", "", "Confluence password. (Alternatively set CONFLUENCE_PASSWORD environment variable)")
+	rootCmd.PersistentFlags().StringVar(&m.Flavor, "flavor", renderer.FlavorCloud, "Confluence the pages are published to: cloud or datacenter (Data Center and Server). (Alternatively set CONFLUENCE_FLAVOR environment variable)")
+	rootCmd.PersistentFlags().StringVar(&m.API, "api", lib.APIv1, "REST API pages are published with: v1, or v2 on Confluence Cloud, which publishes folders without an index file as Confluence folders")
+	rootCmd.PersistentFlags().StringVar(&m.Token, "token", "", "Confluence API token or personal access token. (Alternatively set CONFLUENCE_TOKEN environment variable)")
+	rootCmd.PersistentFlags().StringVar(&m.Auth, "auth", "", "Authentication: basic (username with password or token), bearer (personal access token) or cookie (session cookie in --token), defaults to bearer when only a token is set. (Alternatively set CONFLUENCE_AUTH environment variable)")
 	rootCmd.PersistentFlags().StringVarP(&m.Endpoint, "endpoint", "e", lib.DefaultEndpoint, "Confluence endpoint. (Alternatively set CONFLUENCE_ENDPOINT environment variable)")
 	rootCmd.PersistentFlags().StringVar(&m.Parent, "parent", "", "Optional parent page to next content under")
 	rootCmd.PersistentFlags().BoolVarP(&m.Debug, "debug", "d", false, "Enable debug logging")
@@ -30,6 +35,30 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&m.Title, "title", "t", "", "Set the page title on upload (defaults to filename without extension)")
 	rootCmd.PersistentFlags().StringVarP(&m.GitSyncDir, "git-sync-dir", "g", "", "Example Set the local synchronization directory")
 	rootCmd.PersistentFlags().StringVar(&m.Model, "model", "", "Is it based on git")
+	rootCmd.PersistentFlags().StringVar(&m.From, "from", "", "Git mode: sync the changes after this commit (defaults to the last synced commit)")
+	rootCmd.PersistentFlags().StringVar(&m.To, "to", "", "Git mode: sync the changes up to this commit (defaults to HEAD)")
+	rootCmd.PersistentFlags().BoolVar(&m.Worktree, "worktree", false, "Git mode: also sync uncommitted changes in the working tree")
+	rootCmd.PersistentFlags().BoolVar(&m.DryRun, "dry-run", false, "Print the pages that would be created, updated, moved or deleted without changing Confluence")
+	rootCmd.PersistentFlags().StringVar(&m.StateFile, "state-file", lib.DefaultStateFile, "File recording which Confluence page each markdown file was published to")
+	rootCmd.PersistentFlags().StringVar(&m.OnConflict, "on-conflict", lib.ConflictFail, "What to do with pages edited in Confluence since they were last published: fail, skip or overwrite")
+	rootCmd.PersistentFlags().BoolVar(&m.Force, "force", false, "Overwrite pages edited in Confluence since they were last published, same as --on-conflict=overwrite")
+	rootCmd.PersistentFlags().StringVar(&m.MathMacro, "math-macro", "", "Macro formulas are rendered with: math (mathinline/mathblock), latex or code (default math on cloud, code on datacenter)")
+	rootCmd.PersistentFlags().StringVar(&m.DiagramCache, "diagram-cache", lib.DefaultDiagramCache, "Directory converted diagrams are cached in")
+	rootCmd.PersistentFlags().StringSliceVar(&m.IndexFiles, "index-files", lib.DefaultIndexFiles, "Markdown file names whose content becomes the page of the folder they are in")
+	rootCmd.PersistentFlags().StringVar(&m.FolderTemplate, "folder-template", "", "Storage format file or Go template used for folder pages without an index file")
+	rootCmd.PersistentFlags().BoolVar(&m.OrderPages, "order-pages", false, "Order sibling pages by numeric file name prefixes such as 01-intro.md, which are removed from the titles")
+	rootCmd.PersistentFlags().StringVar(&m.TitleCollision, "title-collision", lib.CollisionFail, "What to do with files and folders that would get the same page title in a space: fail, prefix (with the parent title) or path")
+	rootCmd.PersistentFlags().IntVar(&m.MaxRetries, "max-retries", lib.DefaultMaxRetries, "How often requests rate limited or failed by Confluence are retried, with exponential backoff")
+	rootCmd.PersistentFlags().DurationVar(&m.Timeout, "timeout", lib.DefaultTimeout, "How long a single request to Confluence may take, 0 for no limit")
+	rootCmd.PersistentFlags().StringVar(&m.Proxy, "proxy", "", "Proxy URL for requests to Confluence (defaults to HTTPS_PROXY and HTTP_PROXY)")
+	rootCmd.PersistentFlags().StringSliceVar(&m.CACerts, "ca-cert", []string{}, "PEM files with CA certificates to trust in addition to the system ones")
+	rootCmd.PersistentFlags().StringVar(&m.ClientCert, "client-cert", "", "PEM file with the client certificate for mutual TLS")
+	rootCmd.PersistentFlags().StringVar(&m.ClientKey, "client-key", "", "PEM file with the private key of --client-cert")
+	rootCmd.PersistentFlags().BoolVar(&m.InsecureSkipVerify, "insecure-skip-verify", false, "Do not verify the TLS certificate of Confluence (insecure, for testing only)")
+	rootCmd.PersistentFlags().BoolVar(&m.Prune, "prune", false, "Delete pages below --parent that have no markdown file anymore")
+	rootCmd.PersistentFlags().StringVar(&m.PruneArchive, "prune-archive", "", "Move pruned pages below this page (created under --parent) instead of deleting them")
+	rootCmd.PersistentFlags().StringSliceVar(&m.PruneKeep, "prune-keep", []string{}, "list of page title patterns (regex) that are never pruned")
+	rootCmd.PersistentFlags().IntVar(&m.PruneLimit, "prune-limit", lib.DefaultPruneLimit, "Maximum number of pages --prune may remove in one run")
 	rootCmd.PersistentFlags().StringSliceVarP(&m.ExcludeFilePatterns, "exclude", "x", []string{}, "list of exclude file patterns (regex) for that will be applied on markdown file paths")
 	err := conf.LoadConfig()
 	if err == nil {
@@ -64,6 +93,10 @@ var rootCmd = &cobra.Command{
 			errors = m.Run()
 		}
 
+		if m.DryRun && m.Plan != nil {
+			m.Plan.Print(os.Stdout)
+		}
+
 		for _, err := range errors {
 			fmt.Println()
 			fmt.Println(err)
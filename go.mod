@@ -1,6 +1,6 @@
 module markdownToConfluence
 
-go 1.12
+go 1.13
 
 require (
 	github.com/google/go-querystring v1.0.0 // indirect
@@ -11,4 +11,5 @@ require (
 	github.com/stretchr/objx v0.1.1 // indirect
 	github.com/yuin/goldmark v1.1.25
 	golang.org/x/sys v0.0.0-20220403205710-6acee93ad0eb // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
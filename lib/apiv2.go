@@ -0,0 +1,479 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/justmiles/go-confluence"
+
+	r "markdownToConfluence/lib/renderer"
+)
+
+// Versions of the Confluence REST API pages are published with
+const (
+	// APIv1 is the content API of Confluence Cloud and Data Center
+	APIv1 = "v1"
+	// APIv2 is the API of Confluence Cloud, which also has folders
+	APIv2 = "v2"
+)
+
+// api returns the --api version, v1 unless set
+func (m *Markdown2Confluence) api() string {
+	if m.API == "" {
+		return APIv1
+	}
+	return m.API
+}
+
+// validateAPI checks that the --api version is available on the --flavor
+func (m Markdown2Confluence) validateAPI() error {
+	switch m.API {
+	case "", APIv1:
+	case APIv2:
+		if m.flavor() != r.FlavorCloud {
+			return fmt.Errorf("--api %s is only available on Confluence Cloud", APIv2)
+		}
+	default:
+		return fmt.Errorf("--api must be %s or %s", APIv1, APIv2)
+	}
+	return nil
+}
+
+// useFolders reports whether folders without an index file are published as
+// Confluence folders rather than pages. A --folder-template asks for pages.
+func (m *Markdown2Confluence) useFolders() bool {
+	return m.api() == APIv2 && m.FolderTemplate == ""
+}
+
+// The methods below implement the content methods of Client with the v2
+// API. It has no endpoints to search, add labels or upload attachments,
+// those are still done with v1, which Confluence Cloud keeps serving.
+
+// v2Version is the version of a page or property
+type v2Version struct {
+	Number  int    `json:"number"`
+	Message string `json:"message,omitempty"`
+}
+
+// v2Body is the body of a page sent to Confluence
+type v2Body struct {
+	Representation string `json:"representation"`
+	Value          string `json:"value"`
+}
+
+// v2Page is a page or folder of the v2 API
+type v2Page struct {
+	ID       string     `json:"id,omitempty"`
+	Type     string     `json:"type,omitempty"`
+	Status   string     `json:"status,omitempty"`
+	Title    string     `json:"title,omitempty"`
+	SpaceID  string     `json:"spaceId,omitempty"`
+	ParentID string     `json:"parentId,omitempty"`
+	Version  *v2Version `json:"version,omitempty"`
+	Body     struct {
+		Storage *v2Body `json:"storage,omitempty"`
+	} `json:"body"`
+	Labels struct {
+		Results []struct {
+			Name string `json:"name"`
+		} `json:"results"`
+	} `json:"labels"`
+	Links struct {
+		Webui  string `json:"webui"`
+		Tinyui string `json:"tinyui"`
+	} `json:"_links"`
+}
+
+// v2PageRequest creates or updates a page, or creates a folder
+type v2PageRequest struct {
+	ID       string     `json:"id,omitempty"`
+	Status   string     `json:"status,omitempty"`
+	Title    string     `json:"title"`
+	SpaceID  string     `json:"spaceId,omitempty"`
+	ParentID string     `json:"parentId,omitempty"`
+	Body     *v2Body    `json:"body,omitempty"`
+	Version  *v2Version `json:"version,omitempty"`
+}
+
+// v2Child is an entry of the direct children of a page or folder
+type v2Child struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+}
+
+// spaceID returns the ID of the space with the given key, which the v2 API
+// identifies spaces by
+func (client *Client) spaceID(key string) (string, error) {
+	client.spacesMu.Lock()
+	defer client.spacesMu.Unlock()
+	if id, ok := client.spaceIDs[key]; ok {
+		return id, nil
+	}
+
+	params := url.Values{}
+	params.Set("keys", key)
+	var response struct {
+		Results []struct {
+			ID  string `json:"id"`
+			Key string `json:"key"`
+		} `json:"results"`
+	}
+	if err := client.request("GET", "/api/v2/spaces", params, nil, &response); err != nil {
+		return "", err
+	}
+	if len(response.Results) == 0 {
+		return "", fmt.Errorf("space %s does not exist", key)
+	}
+	client.cacheSpace(response.Results[0].ID, key)
+	return response.Results[0].ID, nil
+}
+
+// spaceKey returns the key of the space with the given ID
+func (client *Client) spaceKey(id string) (string, error) {
+	client.spacesMu.Lock()
+	defer client.spacesMu.Unlock()
+	if key, ok := client.spaceKeys[id]; ok {
+		return key, nil
+	}
+
+	var space struct {
+		Key string `json:"key"`
+	}
+	if err := client.request("GET", "/api/v2/spaces/"+url.PathEscape(id), nil, nil, &space); err != nil {
+		return "", err
+	}
+	client.cacheSpace(id, space.Key)
+	return space.Key, nil
+}
+
+// cacheSpace remembers the key and ID of a space, with spacesMu held
+func (client *Client) cacheSpace(id, key string) {
+	if client.spaceIDs == nil {
+		client.spaceIDs = make(map[string]string)
+		client.spaceKeys = make(map[string]string)
+	}
+	client.spaceIDs[key] = id
+	client.spaceKeys[id] = key
+}
+
+// v2Content converts a v2 page to the content the rest of lib works with.
+// Only the direct parent is known, as the last of the ancestors.
+func (client *Client) v2Content(page v2Page) (confluence.Content, error) {
+	var content confluence.Content
+	content.ID = page.ID
+	content.Type = page.Type
+	if content.Type == "" {
+		content.Type = "page"
+	}
+	content.Status = page.Status
+	content.Title = page.Title
+	if page.ParentID != "" {
+		content.Ancestors = append(content.Ancestors, Ancestor{ID: page.ParentID})
+	}
+	if page.Version != nil {
+		content.Version.Number = page.Version.Number
+		content.Version.Message = page.Version.Message
+	}
+	if page.Body.Storage != nil {
+		content.Body.Storage.Representation = page.Body.Storage.Representation
+		content.Body.Storage.Value = page.Body.Storage.Value
+	}
+	content.Links.Webui = page.Links.Webui
+	content.Links.Tinyui = page.Links.Tinyui
+
+	if page.SpaceID != "" {
+		key, err := client.spaceKey(page.SpaceID)
+		if err != nil {
+			return content, err
+		}
+		content.Space.Key = key
+	}
+	return content, nil
+}
+
+// v2PageParams returns the query parameters reading a page with expand,
+// which is given as for v1
+func v2PageParams(expand []string) url.Values {
+	params := url.Values{}
+	for _, e := range expand {
+		if e == "body.storage" {
+			params.Set("body-format", "storage")
+		}
+	}
+	return params
+}
+
+// v2GetContentByID returns a page, or nil if it does not exist
+func (client *Client) v2GetContentByID(id string, expand []string) (*confluence.Content, error) {
+	var page v2Page
+	err := client.request("GET", "/api/v2/pages/"+url.PathEscape(id), v2PageParams(expand), nil, &page)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if page.Status != "" && page.Status != "current" {
+		return nil, nil
+	}
+	content, err := client.v2Content(page)
+	if err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+// v2CreateContent creates a page
+func (client *Client) v2CreateContent(bp *confluence.CreateContentBodyParameters) (confluence.Content, error) {
+	spaceID, err := client.spaceID(bp.Space.Key)
+	if err != nil {
+		return confluence.Content{}, err
+	}
+	req := v2PageRequest{
+		Status:  "current",
+		Title:   bp.Title,
+		SpaceID: spaceID,
+		Body:    &v2Body{Representation: "storage", Value: bp.Body.Storage.Value},
+	}
+	if len(bp.Ancestors) > 0 {
+		req.ParentID = bp.Ancestors[len(bp.Ancestors)-1].ID
+	}
+
+	var page v2Page
+	if err := client.request("POST", "/api/v2/pages", nil, req, &page); err != nil {
+		return confluence.Content{}, err
+	}
+	return client.v2Content(page)
+}
+
+// v2UpdateContent updates the title, body or parent of a page
+func (client *Client) v2UpdateContent(content *confluence.Content) (confluence.Content, error) {
+	req := v2PageRequest{
+		ID:      content.ID,
+		Status:  "current",
+		Title:   content.Title,
+		Body:    &v2Body{Representation: "storage", Value: content.Body.Storage.Value},
+		Version: &v2Version{Number: content.Version.Number, Message: content.Version.Message},
+	}
+	if len(content.Ancestors) > 0 {
+		req.ParentID = content.Ancestors[len(content.Ancestors)-1].ID
+	}
+
+	var page v2Page
+	if err := client.request("PUT", "/api/v2/pages/"+url.PathEscape(content.ID), nil, req, &page); err != nil {
+		return *content, err
+	}
+	return client.v2Content(page)
+}
+
+// v2DeleteContent moves a page or folder to the trash of its space
+func (client *Client) v2DeleteContent(content confluence.Content) error {
+	if content.Type == "folder" {
+		return client.request("DELETE", "/api/v2/folders/"+url.PathEscape(content.ID), nil, nil, nil)
+	}
+	return client.request("DELETE", "/api/v2/pages/"+url.PathEscape(content.ID), nil, nil, nil)
+}
+
+// CreateFolder creates a Confluence folder below the page or folder
+// parentID, or at the top of the space when it is empty
+func (client *Client) CreateFolder(space, title, parentID string) (confluence.Content, error) {
+	spaceID, err := client.spaceID(space)
+	if err != nil {
+		return confluence.Content{}, err
+	}
+
+	var folder v2Page
+	req := v2PageRequest{Title: title, SpaceID: spaceID, ParentID: parentID}
+	if err := client.request("POST", "/api/v2/folders", nil, req, &folder); err != nil {
+		return confluence.Content{}, err
+	}
+	folder.Type = "folder"
+	return client.v2Content(folder)
+}
+
+// directChildren returns the pages, folders and other content directly
+// below the page or folder id, in the order they are shown in Confluence
+func (client *Client) directChildren(id string) ([]v2Child, error) {
+	var children []v2Child
+	decode := func(raw json.RawMessage) (int, error) {
+		var page []v2Child
+		err := json.Unmarshal(raw, &page)
+		children = append(children, page...)
+		return len(page), err
+	}
+
+	// The ID does not tell pages and folders apart
+	err := client.paginate("/api/v2/pages/"+url.PathEscape(id)+"/direct-children", nil, decode)
+	if isNotFound(err) {
+		err = client.paginate("/api/v2/folders/"+url.PathEscape(id)+"/direct-children", nil, decode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return children, nil
+}
+
+// FindChild returns the page or folder, as given by kind, titled title
+// directly below the page or folder parentID, or nil if there is none. Only
+// its ID, type and title are set.
+func (client *Client) FindChild(parentID, title, kind string) (*confluence.Content, error) {
+	children, err := client.directChildren(parentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		if child.Type == kind && child.Title == title {
+			return &confluence.Content{ID: child.ID, Type: child.Type, Title: child.Title}, nil
+		}
+	}
+	return nil, nil
+}
+
+// v2GetChildPageIDs returns the IDs of the pages and folders below a page
+// or folder
+func (client *Client) v2GetChildPageIDs(id string) ([]string, error) {
+	children, err := client.directChildren(id)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, child := range children {
+		if child.Type == "page" || child.Type == "folder" {
+			ids = append(ids, child.ID)
+		}
+	}
+	return ids, nil
+}
+
+// v2GetPage returns a page including its body and labels
+func (client *Client) v2GetPage(id string) (*Page, error) {
+	params := url.Values{}
+	params.Set("body-format", "storage")
+	params.Set("include-labels", "true")
+
+	var page v2Page
+	if err := client.request("GET", "/api/v2/pages/"+url.PathEscape(id), params, nil, &page); err != nil {
+		return nil, err
+	}
+	content, err := client.v2Content(page)
+	if err != nil {
+		return nil, err
+	}
+	p := &Page{Content: content}
+	p.Metadata.Labels.Results = page.Labels.Results
+	return p, nil
+}
+
+// v2GetChildPages returns the pages and folders directly below a page or
+// folder. Folders have no body and the type folder.
+func (client *Client) v2GetChildPages(id string) ([]Page, error) {
+	children, err := client.directChildren(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []Page
+	for _, child := range children {
+		switch child.Type {
+		case "page":
+			page, err := client.v2GetPage(child.ID)
+			if err != nil {
+				return nil, err
+			}
+			pages = append(pages, *page)
+		case "folder":
+			var folder Page
+			folder.ID, folder.Type, folder.Title = child.ID, child.Type, child.Title
+			folder.Ancestors = append(folder.Ancestors, Ancestor{ID: id})
+			pages = append(pages, folder)
+		}
+	}
+	return pages, nil
+}
+
+// v2Attachment is an attachment of the v2 API
+type v2Attachment struct {
+	ID           string    `json:"id"`
+	Status       string    `json:"status"`
+	Title        string    `json:"title"`
+	MediaType    string    `json:"mediaType"`
+	DownloadLink string    `json:"downloadLink"`
+	Version      v2Version `json:"version"`
+}
+
+// v2GetAttachmentByFilename returns the attachment of a page with the given
+// file name, or an error if there is none
+func (client *Client) v2GetAttachmentByFilename(contentID, filename string) (*confluence.Attachment, error) {
+	params := url.Values{}
+	params.Set("filename", filename)
+
+	var response struct {
+		Results []v2Attachment `json:"results"`
+	}
+	if err := client.request("GET", "/api/v2/pages/"+url.PathEscape(contentID)+"/attachments", params, nil, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Results) < 1 {
+		return nil, fmt.Errorf("attachment %s not found", filename)
+	}
+
+	a := response.Results[0]
+	attachment := &confluence.Attachment{ID: a.ID, Type: "attachment", Status: a.Status, Title: a.Title}
+	attachment.Metadata.MediaType = a.MediaType
+	attachment.Version.Number = a.Version.Number
+	return attachment, nil
+}
+
+// v2Attachments returns the title and download link, relative to the
+// endpoint, of every attachment of a page
+func (client *Client) v2Attachments(contentID string) ([]v2Attachment, error) {
+	var attachments []v2Attachment
+	err := client.paginate("/api/v2/pages/"+url.PathEscape(contentID)+"/attachments", nil, func(raw json.RawMessage) (int, error) {
+		var page []v2Attachment
+		err := json.Unmarshal(raw, &page)
+		attachments = append(attachments, page...)
+		return len(page), err
+	})
+	return attachments, err
+}
+
+// v2SetContentProperty creates or updates the content property key of a page
+func (client *Client) v2SetContentProperty(contentID, key string, value interface{}) error {
+	endpoint := "/api/v2/pages/" + url.PathEscape(contentID) + "/properties"
+
+	params := url.Values{}
+	params.Set("key", key)
+	var response struct {
+		Results []contentProperty `json:"results"`
+	}
+	if err := client.request("GET", endpoint, params, nil, &response); err != nil {
+		return err
+	}
+	if len(response.Results) == 0 {
+		return client.request("POST", endpoint, nil, contentProperty{Key: key, Value: value}, nil)
+	}
+
+	current := response.Results[0]
+	property := contentProperty{Key: key, Value: value, Version: &contentVersion{Number: 1}}
+	if current.Version != nil {
+		property.Version.Number = current.Version.Number + 1
+	}
+	return client.request("PUT", endpoint+"/"+url.PathEscape(current.ID), nil, property, nil)
+}
+
+// relativeLink returns a link of a paginated response relative to the
+// endpoint. v1 gives the context path separately, v2 includes it.
+func (client *Client) relativeLink(link, context string) string {
+	if context == "" {
+		if u, err := url.Parse(client.Endpoint); err == nil {
+			context = strings.TrimSuffix(u.Path, "/")
+		}
+	}
+	if context != "" {
+		link = strings.TrimPrefix(link, context)
+	}
+	return link
+}
@@ -0,0 +1,269 @@
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/justmiles/go-confluence"
+)
+
+func TestSpaceIDAndKey(t *testing.T) {
+	requests := make(map[string]int)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/spaces", func(w http.ResponseWriter, req *http.Request) {
+		requests[req.URL.String()]++
+		switch req.URL.Query().Get("keys") {
+		case "DOCS":
+			w.Write([]byte(`{"results":[{"id":"100","key":"DOCS"}]}`))
+		default:
+			w.Write([]byte(`{"results":[]}`))
+		}
+	})
+	mux.HandleFunc("/api/v2/spaces/200", func(w http.ResponseWriter, req *http.Request) {
+		requests[req.URL.String()]++
+		w.Write([]byte(`{"id":"200","key":"API"}`))
+	})
+	client, server := newTestClient(mux)
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		if id, err := client.spaceID("DOCS"); err != nil || id != "100" {
+			t.Errorf("spaceID(DOCS) = %q, %v, want 100", id, err)
+		}
+		if key, err := client.spaceKey("100"); err != nil || key != "DOCS" {
+			t.Errorf("spaceKey(100) = %q, %v, want DOCS", key, err)
+		}
+		if key, err := client.spaceKey("200"); err != nil || key != "API" {
+			t.Errorf("spaceKey(200) = %q, %v, want API", key, err)
+		}
+		if id, err := client.spaceID("API"); err != nil || id != "200" {
+			t.Errorf("spaceID(API) = %q, %v, want 200", id, err)
+		}
+	}
+	if _, err := client.spaceID("NONE"); err == nil || err.Error() != "space NONE does not exist" {
+		t.Errorf("spaceID(NONE) gave %v, want an error", err)
+	}
+
+	want := map[string]int{
+		"/api/v2/spaces?keys=DOCS": 1,
+		"/api/v2/spaces/200":       1,
+		"/api/v2/spaces?keys=NONE": 1,
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %v, want each space looked up once: %v", requests, want)
+	}
+}
+
+func TestDirectChildren(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		children []v2Child
+		requests []string
+		err      bool
+	}{
+		{
+			name:     "page",
+			id:       "1",
+			children: []v2Child{{ID: "11", Type: "page", Title: "a"}, {ID: "12", Type: "folder", Title: "b"}},
+			requests: []string{"/api/v2/pages/1/direct-children"},
+		},
+		{
+			name:     "folder falls back on a 404",
+			id:       "5",
+			children: []v2Child{{ID: "51", Type: "page", Title: "c"}, {ID: "52", Type: "whiteboard", Title: "d"}},
+			requests: []string{"/api/v2/pages/5/direct-children", "/api/v2/folders/5/direct-children", "/api/v2/folders/5/direct-children?cursor=2"},
+		},
+		{
+			name:     "other errors are not retried as folder",
+			id:       "9",
+			requests: []string{"/api/v2/pages/9/direct-children"},
+			err:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				u := req.URL.Path
+				if cursor := req.URL.Query().Get("cursor"); cursor != "" {
+					u += "?cursor=" + cursor
+				}
+				requests = append(requests, u)
+				switch u {
+				case "/api/v2/pages/1/direct-children":
+					w.Write([]byte(`{"results":[{"id":"11","type":"page","title":"a"},{"id":"12","type":"folder","title":"b"}]}`))
+				case "/api/v2/folders/5/direct-children":
+					w.Write([]byte(`{"results":[{"id":"51","type":"page","title":"c"}],"_links":{"next":"/api/v2/folders/5/direct-children?cursor=2"}}`))
+				case "/api/v2/folders/5/direct-children?cursor=2":
+					w.Write([]byte(`{"results":[{"id":"52","type":"whiteboard","title":"d"}]}`))
+				case "/api/v2/pages/9/direct-children":
+					http.Error(w, "unavailable", http.StatusForbidden)
+				default:
+					http.NotFound(w, req)
+				}
+			})
+			client, server := newTestClient(handler)
+			defer server.Close()
+
+			children, err := client.directChildren(tt.id)
+			if tt.err != (err != nil) {
+				t.Fatalf("err = %v, want an error: %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(children, tt.children) {
+				t.Errorf("children = %+v, want %+v", children, tt.children)
+			}
+			if !reflect.DeepEqual(requests, tt.requests) {
+				t.Errorf("requests = %q, want %q", requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestFindChild(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/folders/5/direct-children", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"results":[{"id":"51","type":"page","title":"Guide"},{"id":"52","type":"folder","title":"Guide"}]}`))
+	})
+	client, server := newTestClient(mux)
+	defer server.Close()
+
+	for _, kind := range []string{"page", "folder"} {
+		child, err := client.FindChild("5", "Guide", kind)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if child == nil || child.Type != kind {
+			t.Errorf("FindChild(%s) = %+v, want the %s", kind, child, kind)
+		}
+	}
+	if child, err := client.FindChild("5", "Other", "page"); err != nil || child != nil {
+		t.Errorf("FindChild(Other) = %+v, %v, want nil", child, err)
+	}
+}
+
+func TestV2Content(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/spaces/100", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"id":"100","key":"DOCS"}`))
+	})
+	client, server := newTestClient(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		page    string
+		content func() confluence.Content
+	}{
+		{
+			name: "page",
+			page: `{"id":"1","status":"current","title":"Guide","spaceId":"100","parentId":"7","version":{"number":3,"message":"sync"},"body":{"storage":{"representation":"storage","value":"<p>x</p>"}},"_links":{"webui":"/spaces/DOCS/pages/1","tinyui":"/x/AQ"}}`,
+			content: func() confluence.Content {
+				c := testPage("1", "Guide", "7")
+				c.Type, c.Status = "page", "current"
+				c.Space.Key = "DOCS"
+				c.Version.Number, c.Version.Message = 3, "sync"
+				c.Body.Storage.Representation, c.Body.Storage.Value = "storage", "<p>x</p>"
+				c.Links.Webui, c.Links.Tinyui = "/spaces/DOCS/pages/1", "/x/AQ"
+				return c
+			},
+		},
+		{
+			name: "folder at the top of the space",
+			page: `{"id":"2","type":"folder","title":"Docs"}`,
+			content: func() confluence.Content {
+				c := testPage("2", "Docs")
+				c.Type = "folder"
+				return c
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var page v2Page
+			if err := json.Unmarshal([]byte(tt.page), &page); err != nil {
+				t.Fatal(err)
+			}
+			content, err := client.v2Content(page)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if want := tt.content(); !reflect.DeepEqual(content, want) {
+				t.Errorf("content = %+v, want %+v", content, want)
+			}
+		})
+	}
+}
+
+func TestV2SetContentProperty(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		method   string
+		path     string
+		version  int
+	}{
+		{
+			name:     "new property",
+			existing: `{"results":[]}`,
+			method:   http.MethodPost,
+			path:     "/api/v2/pages/1/properties",
+		},
+		{
+			name:     "existing property",
+			existing: `{"results":[{"id":"9","key":"owner","value":"old","version":{"number":3}}]}`,
+			method:   http.MethodPut,
+			path:     "/api/v2/pages/1/properties/9",
+			version:  4,
+		},
+		{
+			name:     "existing property without a version",
+			existing: `{"results":[{"id":"9","key":"owner","value":"old"}]}`,
+			method:   http.MethodPut,
+			path:     "/api/v2/pages/1/properties/9",
+			version:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var method, path string
+			var sent contentProperty
+			handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodGet {
+					if req.URL.Query().Get("key") != "owner" {
+						t.Errorf("looked up property %q, want owner", req.URL.Query().Get("key"))
+					}
+					w.Write([]byte(tt.existing))
+					return
+				}
+				method, path = req.Method, req.URL.Path
+				json.NewDecoder(req.Body).Decode(&sent)
+				w.Write([]byte(`{}`))
+			})
+			client, server := newTestClient(handler)
+			defer server.Close()
+
+			if err := client.v2SetContentProperty("1", "owner", "docs"); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if method != tt.method || path != tt.path {
+				t.Errorf("sent %s %s, want %s %s", method, path, tt.method, tt.path)
+			}
+			if sent.Key != "owner" || sent.Value != "docs" {
+				t.Errorf("sent property %+v, want owner = docs", sent)
+			}
+			var version int
+			if sent.Version != nil {
+				version = sent.Version.Number
+			}
+			if version != tt.version {
+				t.Errorf("sent version %d, want %d", version, tt.version)
+			}
+		})
+	}
+}
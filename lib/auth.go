@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Ways of authenticating with Confluence
+const (
+	// AuthBasic sends the username with the password or API token
+	AuthBasic = "basic"
+	// AuthBearer sends a personal access token, as Confluence Data Center expects it
+	AuthBearer = "bearer"
+	// AuthCookie sends the session cookie of a logged in browser
+	AuthCookie = "cookie"
+)
+
+// Authenticator adds the credentials of a user to requests sent to Confluence
+type Authenticator interface {
+	Authorize(req *http.Request)
+}
+
+// basicAuth authenticates with a username and a password or API token
+type basicAuth struct {
+	username string
+	password string
+}
+
+func (a basicAuth) Authorize(req *http.Request) {
+	req.SetBasicAuth(a.username, a.password)
+}
+
+// bearerAuth authenticates with a personal access token
+type bearerAuth struct {
+	token string
+}
+
+func (a bearerAuth) Authorize(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+a.token)
+}
+
+// cookieAuth authenticates with a session cookie, given as its value, which
+// is sent as JSESSIONID, or as name=value pairs
+type cookieAuth struct {
+	cookie string
+}
+
+func (a cookieAuth) Authorize(req *http.Request) {
+	if strings.Contains(a.cookie, "=") {
+		req.Header.Set("Cookie", a.cookie)
+	} else {
+		req.Header.Set("Cookie", "JSESSIONID="+a.cookie)
+	}
+}
+
+// auth returns the --auth method, which defaults to bearer when only a
+// token is given
+func (m Markdown2Confluence) auth() string {
+	if m.Auth != "" {
+		return m.Auth
+	}
+	if m.Token != "" && m.Username == "" {
+		return AuthBearer
+	}
+	return AuthBasic
+}
+
+// validateAuth checks that the credentials the --auth method needs are set
+func (m Markdown2Confluence) validateAuth() error {
+	switch m.auth() {
+	case AuthBasic:
+		if m.Username == "" {
+			return fmt.Errorf("--username is not defined")
+		}
+		if m.Password == "" && m.Token == "" {
+			return fmt.Errorf("--password is not defined")
+		}
+	case AuthBearer, AuthCookie:
+		if m.Token == "" {
+			return fmt.Errorf("--token is not defined, it is required by --auth %s", m.auth())
+		}
+	default:
+		return fmt.Errorf("--auth must be one of %s, %s or %s", AuthBasic, AuthBearer, AuthCookie)
+	}
+	return nil
+}
+
+// authenticator returns the Authenticator of the --auth method. With basic
+// authentication the token stands in for a missing password, as Confluence
+// Cloud takes API tokens in its place.
+func (m *Markdown2Confluence) authenticator() Authenticator {
+	switch m.auth() {
+	case AuthBearer:
+		return bearerAuth{token: m.Token}
+	case AuthCookie:
+		return cookieAuth{cookie: m.Token}
+	}
+	password := m.Password
+	if password == "" {
+		password = m.Token
+	}
+	return basicAuth{username: m.Username, password: password}
+}
@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"net/http"
+	"testing"
+
+	r "markdownToConfluence/lib/renderer"
+)
+
+func TestAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		m      Markdown2Confluence
+		err    string
+		header string
+		value  string
+	}{
+		{
+			name:   "Cloud with username and API token",
+			m:      Markdown2Confluence{Flavor: r.FlavorCloud, Username: "me@example.com", Token: "api-token"},
+			header: "Authorization",
+			value:  "Basic bWVAZXhhbXBsZS5jb206YXBpLXRva2Vu",
+		},
+		{
+			name:   "username and password",
+			m:      Markdown2Confluence{Username: "me", Password: "secret"},
+			header: "Authorization",
+			value:  "Basic bWU6c2VjcmV0",
+		},
+		{
+			name:   "password wins over the token with basic auth",
+			m:      Markdown2Confluence{Auth: AuthBasic, Username: "me", Password: "secret", Token: "api-token"},
+			header: "Authorization",
+			value:  "Basic bWU6c2VjcmV0",
+		},
+		{
+			name:   "Data Center with a personal access token",
+			m:      Markdown2Confluence{Flavor: r.FlavorDataCenter, Token: "pat"},
+			header: "Authorization",
+			value:  "Bearer pat",
+		},
+		{
+			name:   "Data Center with an explicit bearer token and a username",
+			m:      Markdown2Confluence{Flavor: r.FlavorDataCenter, Auth: AuthBearer, Username: "me", Token: "pat"},
+			header: "Authorization",
+			value:  "Bearer pat",
+		},
+		{
+			name:   "Data Center with username and personal access token as password",
+			m:      Markdown2Confluence{Flavor: r.FlavorDataCenter, Username: "me", Token: "pat"},
+			header: "Authorization",
+			value:  "Basic bWU6cGF0",
+		},
+		{
+			name:   "session cookie value",
+			m:      Markdown2Confluence{Auth: AuthCookie, Token: "abc"},
+			header: "Cookie",
+			value:  "JSESSIONID=abc",
+		},
+		{
+			name:   "session cookies",
+			m:      Markdown2Confluence{Auth: AuthCookie, Token: "seraph=1; JSESSIONID=abc"},
+			header: "Cookie",
+			value:  "seraph=1; JSESSIONID=abc",
+		},
+		{
+			name: "no credentials",
+			m:    Markdown2Confluence{},
+			err:  "--username is not defined",
+		},
+		{
+			name: "basic without password or token",
+			m:    Markdown2Confluence{Username: "me"},
+			err:  "--password is not defined",
+		},
+		{
+			name: "basic without username",
+			m:    Markdown2Confluence{Auth: AuthBasic, Token: "api-token"},
+			err:  "--username is not defined",
+		},
+		{
+			name: "bearer without token",
+			m:    Markdown2Confluence{Flavor: r.FlavorDataCenter, Auth: AuthBearer, Username: "me", Password: "secret"},
+			err:  "--token is not defined, it is required by --auth bearer",
+		},
+		{
+			name: "cookie without token",
+			m:    Markdown2Confluence{Auth: AuthCookie},
+			err:  "--token is not defined, it is required by --auth cookie",
+		},
+		{
+			name: "unknown method",
+			m:    Markdown2Confluence{Auth: "oauth", Token: "token"},
+			err:  "--auth must be one of basic, bearer or cookie",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.m.validateAuth()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, "https://example.com/rest/api/content", nil)
+			tt.m.authenticator().Authorize(req)
+			if value := req.Header.Get(tt.header); value != tt.value {
+				t.Errorf("%s = %q, want %q", tt.header, value, tt.value)
+			}
+		})
+	}
+}
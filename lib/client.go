@@ -0,0 +1,551 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/justmiles/go-confluence"
+
+	r "markdownToConfluence/lib/renderer"
+)
+
+// Client extends confluence.Client with the endpoints go-confluence does not
+// cover, and sends all requests through a transport that retries them
+type Client struct {
+	*confluence.Client
+
+	// Flavor is the Confluence the client talks to, which decides how
+	// listings are paginated and attachments are uploaded
+	Flavor string
+	// API is the version of the REST API pages are read and written with
+	API         string
+	httpClient  *http.Client
+	auth        Authenticator
+	userOnce    sync.Once
+	currentUser User
+	userErr     error
+	spacesMu    sync.Mutex
+	spaceIDs    map[string]string
+	spaceKeys   map[string]string
+}
+
+// NewClient returns a Client for the given endpoint that authenticates with
+// auth and sends its requests with httpClient
+func NewClient(endpoint string, auth Authenticator, debug bool, httpClient *http.Client) *Client {
+	client := &Client{
+		Client: &confluence.Client{
+			Endpoint: endpoint,
+			Debug:    debug,
+		},
+		httpClient: httpClient,
+		auth:       auth,
+	}
+	if basic, ok := auth.(basicAuth); ok {
+		client.Username, client.Password = basic.username, basic.password
+	}
+	return client
+}
+
+// APIError is returned when Confluence answers a request with an error status
+type APIError struct {
+	Method     string
+	Endpoint   string
+	StatusCode int
+	Status     string
+	// Message is the message of a JSON error response
+	Message string
+	Body    string
+}
+
+// maxErrorBody caps the response body quoted in an APIError
+const maxErrorBody = 500
+
+func (e *APIError) Error() string {
+	detail := e.Message
+	if detail == "" {
+		detail = e.Body
+		if len(detail) > maxErrorBody {
+			detail = detail[:maxErrorBody] + "..."
+		}
+	}
+	if detail == "" {
+		return fmt.Sprintf("%s %s: %s", e.Method, e.Endpoint, e.Status)
+	}
+	return fmt.Sprintf("%s %s: %s: %s", e.Method, e.Endpoint, e.Status, detail)
+}
+
+// Retryable reports whether the request failed because of rate limits or an
+// unavailable server, rather than because it is wrong
+func (e *APIError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isNotFound reports whether err is Confluence answering with a 404
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// request performs an API call, encoding payload as JSON and decoding the
+// response into result when they are not nil
+func (client *Client) request(method, apiEndpoint string, params url.Values, payload, result interface{}) error {
+	var body []byte
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+	return client.send(method, apiEndpoint, params, "application/json", body, result)
+}
+
+// send performs an API call with a body of the given content type
+func (client *Client) send(method, apiEndpoint string, params url.Values, contentType string, payload []byte, result interface{}) error {
+	u := client.Endpoint + apiEndpoint
+	if len(params) > 0 {
+		u = u + "?" + params.Encode()
+	}
+
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	client.authorize(req)
+
+	if client.Debug {
+		fmt.Printf("%s %s\n", method, u)
+	}
+
+	res, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 300 {
+		apiErr := &APIError{
+			Method:     method,
+			Endpoint:   apiEndpoint,
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Body:       strings.TrimSpace(string(resBody)),
+		}
+		var message struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(resBody, &message) == nil {
+			apiErr.Message = message.Message
+		}
+		return apiErr
+	}
+
+	if result != nil && len(resBody) > 0 {
+		return json.Unmarshal(resBody, result)
+	}
+	return nil
+}
+
+// authorize adds the credentials of the client to req
+func (client *Client) authorize(req *http.Request) {
+	req.Header.Set("X-Atlassian-Token", "no-check")
+	client.auth.Authorize(req)
+}
+
+// GetContentByID returns a single piece of content, or nil if it does not exist
+func (client *Client) GetContentByID(id string, expand []string) (*confluence.Content, error) {
+	if client.API == APIv2 {
+		return client.v2GetContentByID(id, expand)
+	}
+	params := url.Values{}
+	if len(expand) > 0 {
+		params.Set("expand", strings.Join(expand, ","))
+	}
+
+	var content confluence.Content
+	err := client.request("GET", "/rest/api/content/"+id, params, nil, &content)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Trashed pages are still returned by ID, but should be treated as gone
+	if content.Status != "" && content.Status != "current" {
+		return nil, nil
+	}
+	return &content, nil
+}
+
+// contentVersion is the version of a piece of content or a content property
+type contentVersion struct {
+	Number int `json:"number"`
+}
+
+// contentProperty is a key/value pair stored on a piece of content
+type contentProperty struct {
+	ID      string          `json:"id,omitempty"`
+	Key     string          `json:"key"`
+	Value   interface{}     `json:"value"`
+	Version *contentVersion `json:"version,omitempty"`
+}
+
+// SetContentProperty creates or updates the content property key of a page
+func (client *Client) SetContentProperty(contentID, key string, value interface{}) error {
+	if client.API == APIv2 {
+		return client.v2SetContentProperty(contentID, key, value)
+	}
+	endpoint := "/rest/api/content/" + contentID + "/property"
+
+	var current contentProperty
+	err := client.request("GET", endpoint+"/"+url.PathEscape(key), nil, nil, &current)
+	if isNotFound(err) {
+		return client.request("POST", endpoint, nil, contentProperty{Key: key, Value: value}, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	property := contentProperty{Key: key, Value: value, Version: &contentVersion{Number: 1}}
+	if current.Version != nil {
+		property.Version.Number = current.Version.Number + 1
+	}
+	return client.request("PUT", endpoint+"/"+url.PathEscape(key), nil, property, nil)
+}
+
+// searchLimit is the page size used when walking paginated results
+const searchLimit = 100
+
+// SearchContent returns all content matching the CQL query, following pagination
+func (client *Client) SearchContent(cql string, expand []string) ([]confluence.Content, error) {
+	params := url.Values{}
+	params.Set("cql", cql)
+	if len(expand) > 0 {
+		params.Set("expand", strings.Join(expand, ","))
+	}
+
+	var results []confluence.Content
+	err := client.paginate("/rest/api/content/search", params, func(raw json.RawMessage) (int, error) {
+		var page []confluence.Content
+		err := json.Unmarshal(raw, &page)
+		results = append(results, page...)
+		return len(page), err
+	})
+	return results, err
+}
+
+// paginate requests all pages of a listing endpoint, passing the results
+// of each to decode, which returns how many there were. Confluence Cloud
+// pages with cursors in the next link and may return fewer results than
+// asked for; Data Center pages with start and limit.
+func (client *Client) paginate(apiEndpoint string, params url.Values, decode func(results json.RawMessage) (int, error)) error {
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = values
+	}
+	query.Set("limit", fmt.Sprint(searchLimit))
+
+	cursors := client.Flavor != r.FlavorDataCenter
+	for start := 0; ; {
+		if !cursors {
+			query.Set("start", fmt.Sprint(start))
+		}
+
+		var response struct {
+			Results json.RawMessage `json:"results"`
+			Limit   int             `json:"limit"`
+			Links   struct {
+				Next    string `json:"next"`
+				Context string `json:"context"`
+			} `json:"_links"`
+		}
+		if err := client.request("GET", apiEndpoint, query, nil, &response); err != nil {
+			return err
+		}
+		n, err := decode(response.Results)
+		if err != nil {
+			return err
+		}
+
+		if cursors {
+			if response.Links.Next == "" {
+				return nil
+			}
+			next, err := url.Parse(client.relativeLink(response.Links.Next, response.Links.Context))
+			if err != nil {
+				return fmt.Errorf("invalid next page %s: %s", response.Links.Next, err)
+			}
+			apiEndpoint, query = next.Path, next.Query()
+			continue
+		}
+
+		limit := response.Limit
+		if limit == 0 {
+			limit = searchLimit
+		}
+		if n == 0 || n < limit {
+			return nil
+		}
+		start += n
+	}
+}
+
+// User is a Confluence user. Cloud identifies users by AccountID, Server
+// and Data Center by Username and UserKey.
+type User struct {
+	AccountID   string `json:"accountId,omitempty"`
+	Username    string `json:"username,omitempty"`
+	UserKey     string `json:"userKey,omitempty"`
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// Is reports whether u and other are the same user
+func (u User) Is(other User) bool {
+	switch {
+	case u.AccountID != "" && other.AccountID != "":
+		return u.AccountID == other.AccountID
+	case u.UserKey != "" && other.UserKey != "":
+		return u.UserKey == other.UserKey
+	default:
+		return u.Username != "" && u.Username == other.Username
+	}
+}
+
+// CurrentUser returns the user the client is authenticated as
+func (client *Client) CurrentUser() (User, error) {
+	client.userOnce.Do(func() {
+		client.userErr = client.request("GET", "/rest/api/user/current", nil, nil, &client.currentUser)
+	})
+	return client.currentUser, client.userErr
+}
+
+// PageVersion is a version of a page together with its author
+type PageVersion struct {
+	Number int    `json:"number"`
+	When   string `json:"when"`
+	By     User   `json:"by"`
+}
+
+// GetVersion returns the latest version of a page
+func (client *Client) GetVersion(contentID string) (PageVersion, error) {
+	var content struct {
+		Version PageVersion `json:"version"`
+	}
+	params := url.Values{}
+	params.Set("expand", "version")
+	err := client.request("GET", "/rest/api/content/"+contentID, params, nil, &content)
+	return content.Version, err
+}
+
+// GetHistoricalContent returns the given version of a page including its body
+func (client *Client) GetHistoricalContent(contentID string, version int) (*confluence.Content, error) {
+	params := url.Values{}
+	params.Set("status", "historical")
+	params.Set("version", fmt.Sprint(version))
+	params.Set("expand", "body.storage,version")
+
+	var content confluence.Content
+	if err := client.request("GET", "/rest/api/content/"+contentID, params, nil, &content); err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+// Page is a page together with its labels, which go-confluence does not decode
+type Page struct {
+	confluence.Content
+	Metadata struct {
+		Labels struct {
+			Results []struct {
+				Name string `json:"name"`
+			} `json:"results"`
+		} `json:"labels"`
+	} `json:"metadata"`
+}
+
+// Labels returns the names of the labels of the page
+func (p Page) Labels() []string {
+	var labels []string
+	for _, label := range p.Metadata.Labels.Results {
+		labels = append(labels, label.Name)
+	}
+	return labels
+}
+
+// pageExpand is what GetPage and GetChildPages expand
+const pageExpand = "body.storage,version,space,ancestors,metadata.labels"
+
+// GetPage returns the page with the given ID including its body and labels
+func (client *Client) GetPage(id string) (*Page, error) {
+	if client.API == APIv2 {
+		return client.v2GetPage(id)
+	}
+	params := url.Values{}
+	params.Set("expand", pageExpand)
+
+	var page Page
+	if err := client.request("GET", "/rest/api/content/"+id, params, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// GetChildPages returns the direct child pages of a page, following
+// pagination, and with the v2 API also its folders
+func (client *Client) GetChildPages(id string) ([]Page, error) {
+	if client.API == APIv2 {
+		return client.v2GetChildPages(id)
+	}
+	params := url.Values{}
+	params.Set("expand", pageExpand)
+
+	var pages []Page
+	err := client.paginate("/rest/api/content/"+id+"/child/page", params, func(raw json.RawMessage) (int, error) {
+		var page []Page
+		err := json.Unmarshal(raw, &page)
+		pages = append(pages, page...)
+		return len(page), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// GetChildPageIDs returns the IDs of the child pages of a page, or of the
+// pages at the root of space when id is empty, in the order they are shown
+// in Confluence
+func (client *Client) GetChildPageIDs(space, id string) ([]string, error) {
+	if client.API == APIv2 && id != "" {
+		return client.v2GetChildPageIDs(id)
+	}
+	endpoint := "/rest/api/content/" + id + "/child/page"
+	params := url.Values{}
+	if id == "" {
+		endpoint = "/rest/api/space/" + url.PathEscape(space) + "/content/page"
+		params.Set("depth", "root")
+	}
+
+	var ids []string
+	err := client.paginate(endpoint, params, func(raw json.RawMessage) (int, error) {
+		var page []struct {
+			ID string `json:"id"`
+		}
+		err := json.Unmarshal(raw, &page)
+		for _, p := range page {
+			ids = append(ids, p.ID)
+		}
+		return len(page), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// MovePage moves a page before or after targetID, or appends it to the
+// children of targetID, depending on position
+func (client *Client) MovePage(id, position, targetID string) error {
+	return client.request("PUT", "/rest/api/content/"+id+"/move/"+position+"/"+targetID, nil, nil, nil)
+}
+
+// DownloadAttachments saves all attachments of a page into directory,
+// replacing files of the same name, and returns the paths written.
+// go-confluence's DownloadAttachmentsFromPage decodes the file contents as
+// JSON and never overwrites, so it cannot be used to refresh a checkout.
+func (client *Client) DownloadAttachments(contentID, directory string) ([]string, error) {
+	var files []string
+	if client.API == APIv2 {
+		attachments, err := client.v2Attachments(contentID)
+		if err != nil {
+			return nil, err
+		}
+		for _, attachment := range attachments {
+			p := filepath.Join(directory, filepath.Base(attachment.Title))
+			if err := client.download(client.Endpoint+attachment.DownloadLink, p); err != nil {
+				return nil, fmt.Errorf("Error downloading %s: %s", attachment.Title, err)
+			}
+			files = append(files, p)
+		}
+		return files, nil
+	}
+
+	err := client.paginate(attachmentEndpoint(contentID), nil, func(raw json.RawMessage) (int, error) {
+		var page []struct {
+			Title string `json:"title"`
+			Links struct {
+				Download string `json:"download"`
+			} `json:"_links"`
+		}
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return 0, err
+		}
+
+		for _, attachment := range page {
+			p := filepath.Join(directory, filepath.Base(attachment.Title))
+			if err := client.download(client.Endpoint+attachment.Links.Download, p); err != nil {
+				return 0, fmt.Errorf("Error downloading %s: %s", attachment.Title, err)
+			}
+			files = append(files, p)
+		}
+		return len(page), nil
+	})
+	return files, err
+}
+
+// download writes the resource at u to the file p
+func (client *Client) download(u, p string) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	client.authorize(req)
+
+	res, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return &APIError{Method: "GET", Endpoint: u, StatusCode: res.StatusCode, Status: res.Status}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, res.Body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,287 @@
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/justmiles/go-confluence"
+
+	r "markdownToConfluence/lib/renderer"
+)
+
+// Strategies for pages of different files or folders that would get the same
+// title, which Confluence does not allow within a space
+const (
+	CollisionFail   = "fail"
+	CollisionPrefix = "prefix"
+	CollisionPath   = "path"
+)
+
+// titleSource is a markdown file or folder that a page is published for
+type titleSource struct {
+	// path is the file, or the folder for folder pages and index files
+	path   string
+	root   string
+	title  string
+	parent string
+}
+
+// rel returns the path of s below the directory it was synced from
+func (s titleSource) rel() string {
+	if rel, err := filepath.Rel(s.root, s.path); err == nil && s.root != "" {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(s.path)
+}
+
+// key identifies s independent of the directory the sync runs in
+func (s titleSource) key() string {
+	if abs, err := filepath.Abs(s.path); err == nil {
+		return abs
+	}
+	return s.path
+}
+
+// titleCollision returns the --title-collision strategy
+func (m *Markdown2Confluence) titleCollision() string {
+	if m.TitleCollision == "" {
+		return CollisionFail
+	}
+	return m.TitleCollision
+}
+
+// disambiguate returns the title of the page of s under the prefix or path strategy
+func (m *Markdown2Confluence) disambiguate(s titleSource, strategy string) string {
+	if strategy == CollisionPrefix && s.parent != "" {
+		return s.parent + " - " + s.title
+	}
+	return s.title + " (" + s.rel() + ")"
+}
+
+// pageSources returns the sources of the page of md and of the folder
+// pages above it that are derived from its location
+func (m *Markdown2Confluence) pageSources(md MarkdownFile) []titleSource {
+	var sources []titleSource
+
+	page := titleSource{path: md.Path, root: md.root, title: md.Title}
+	if m.isIndexFile(md.Path) && strings.Contains(md.Path, "/") && md.root != "" {
+		page.path = filepath.Dir(md.Path)
+	}
+	if len(md.Parents) > 0 {
+		page.parent = md.Parents[len(md.Parents)-1]
+	}
+	sources = append(sources, page)
+
+	offset := len(md.Parents) - len(md.parentDirs)
+	for i, dir := range md.parentDirs {
+		folder := titleSource{path: dir, root: md.root, title: md.Parents[offset+i]}
+		if offset+i > 0 {
+			folder.parent = md.Parents[offset+i-1]
+		}
+		sources = append(sources, folder)
+	}
+	return sources
+}
+
+// resolveTitles finds the files and folders of the indexed pages that would
+// be published with the same title in a space, and gives them distinct
+// titles according to --title-collision. The links, sync titles and page
+// order are indexed with the resulting titles.
+func (m *Markdown2Confluence) resolveTitles() error {
+	groups := make(map[string][]titleSource)
+	for _, md := range m.indexed {
+		for _, s := range m.pageSources(md) {
+			key := md.space(m) + ":" + s.title
+			known := false
+			for _, other := range groups[key] {
+				known = known || other.key() == s.key()
+			}
+			if !known {
+				groups[key] = append(groups[key], s)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	m.titles = make(map[string]string)
+	for _, key := range keys {
+		sources := groups[key]
+		if len(sources) < 2 {
+			continue
+		}
+
+		strategy := m.titleCollision()
+		if strategy == CollisionFail {
+			var paths []string
+			for _, s := range sources {
+				paths = append(paths, s.rel())
+			}
+			parts := strings.SplitN(key, ":", 2)
+			return fmt.Errorf("%s in space %s would all be published as page %q, rename them or use --title-collision %s or %s",
+				strings.Join(paths, ", "), parts[0], parts[1], CollisionPrefix, CollisionPath)
+		}
+
+		// Sources with the same parent title still collide with the prefix
+		titles := make(map[string]bool)
+		for _, s := range sources {
+			titles[m.disambiguate(s, strategy)] = true
+		}
+		if len(titles) < len(sources) {
+			strategy = CollisionPath
+		}
+		for _, s := range sources {
+			m.titles[s.key()] = m.disambiguate(s, strategy)
+		}
+	}
+
+	m.pages = make(map[string]r.PageLink)
+	m.syncPaths = make(map[string]bool)
+	m.siblings = nil
+	for i := range m.indexed {
+		m.applyTitles(&m.indexed[i])
+		md := m.indexed[i]
+		if abs, err := filepath.Abs(md.Path); err == nil {
+			m.pages[abs] = r.PageLink{Title: md.Title, Space: md.space(m)}
+		}
+		path := append(md.Parents[:len(md.Parents):len(md.Parents)], md.Title)
+		for i := range path {
+			m.syncPaths[pagePathKey(md.space(m), path[:i+1])] = true
+		}
+		m.indexOrder(md)
+	}
+	return nil
+}
+
+// applyTitles gives the page of md, and the folder pages above it, the
+// titles chosen by resolveTitles
+func (m *Markdown2Confluence) applyTitles(md *MarkdownFile) {
+	if len(m.titles) == 0 {
+		return
+	}
+	sources := m.pageSources(*md)
+	if title, ok := m.titles[sources[0].key()]; ok {
+		md.Title = title
+	}
+
+	parents := append([]string(nil), md.Parents...)
+	offset := len(md.Parents) - len(md.parentDirs)
+	for i, dir := range md.parentDirs {
+		if title, ok := m.titles[titleSource{path: dir}.key()]; ok {
+			parents[offset+i] = title
+		}
+	}
+	md.Parents = parents
+}
+
+// remoteCollision handles a page titled like the page of source that is
+// found elsewhere in the space, and returns the title to publish source
+// with instead
+func (m *Markdown2Confluence) remoteCollision(source titleSource, space string, existing confluence.Content) (string, error) {
+	strategy := m.titleCollision()
+	if strategy == CollisionFail {
+		location := "at the top of the space"
+		if len(existing.Ancestors) > 0 {
+			location = "below page " + existing.Ancestors[len(existing.Ancestors)-1].ID
+		}
+		return "", fmt.Errorf("%s would be published as page %q, which already exists in space %s as page %s %s, rename one of them or use --title-collision %s or %s",
+			source.rel(), source.title, space, existing.ID, location, CollisionPrefix, CollisionPath)
+	}
+	return m.disambiguate(source, strategy), nil
+}
+
+// findChildPage looks up the page titled title directly below the page
+// parentID, so that pages of the same title elsewhere in the space are not
+// mistaken for it
+func (m *Markdown2Confluence) findChildPage(space, title, parentID string, expand []string) (*confluence.Content, error) {
+	// The parent may be a folder, which is listed rather than searched
+	if m.client.API == APIv2 {
+		child, err := m.client.FindChild(parentID, title, "page")
+		if err != nil || child == nil {
+			return nil, err
+		}
+		return m.client.GetContentByID(child.ID, expand)
+	}
+
+	cql := fmt.Sprintf("type = page and space = %s and title = %s and parent = %s", cqlString(space), cqlString(title), parentID)
+	results, err := m.client.SearchContent(cql, expand)
+	if err != nil {
+		return nil, err
+	}
+	for _, content := range results {
+		if content.Title == title {
+			return &content, nil
+		}
+	}
+	return nil, nil
+}
+
+// findAncestor looks up the parent page titled title below the page or
+// folder ancestorID, or anywhere in the space when ancestorID is empty.
+// With folder, a Confluence folder of that title is looked up as well.
+func (m *Markdown2Confluence) findAncestor(space, title, ancestorID string, folder bool) (*confluence.Content, error) {
+	var existing *confluence.Content
+	var err error
+	if isPageID(ancestorID) {
+		existing, err = m.findChildPage(space, title, ancestorID, nil)
+	} else if ancestorID == "" {
+		existing, err = m.findSpacePage(space, title, nil)
+	}
+	if err != nil || existing != nil || !folder {
+		return existing, err
+	}
+
+	if isPageID(ancestorID) {
+		return m.client.FindChild(ancestorID, title, "folder")
+	} else if ancestorID == "" {
+		return m.findSpaceFolder(space, title)
+	}
+	return nil, nil
+}
+
+// findSpaceFolder looks up the folder titled title anywhere in the space
+func (m *Markdown2Confluence) findSpaceFolder(space, title string) (*confluence.Content, error) {
+	cql := fmt.Sprintf("type = folder and space = %s and title = %s", cqlString(space), cqlString(title))
+	results, err := m.client.SearchContent(cql, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, content := range results {
+		if content.Title == title {
+			return &content, nil
+		}
+	}
+	return nil, nil
+}
+
+// findSpacePage looks up the page titled title anywhere in the space
+func (m *Markdown2Confluence) findSpacePage(space, title string, expand []string) (*confluence.Content, error) {
+	results, err := m.client.GetContent(&confluence.GetContentQueryParameters{
+		Title:    title,
+		Spacekey: space,
+		Limit:    1,
+		Type:     "page",
+		Expand:   expand,
+	})
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// isPageID reports whether id is the ID of a page in Confluence, rather
+// than empty or a page that is only planned in a dry run
+func isPageID(id string) bool {
+	return id != "" && !strings.HasPrefix(id, dryRunPrefix)
+}
+
+// cqlString quotes s for use in a CQL query
+func cqlString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
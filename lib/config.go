@@ -6,16 +6,59 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
+
+	r "markdownToConfluence/lib/renderer"
 )
 
 type ConfluenceConfig struct {
-	Username   string
-	Password   string
-	Endpoint   string
-	Space      string
-	Parent     string
-	GitSyncDir string
-	Model      string
+	Username           string
+	Password           string
+	Token              string
+	Auth               string
+	Flavor             string
+	API                string
+	Endpoint           string
+	Space              string
+	Parent             string
+	GitSyncDir         string
+	Model              string
+	StateFile          string
+	OnConflict         string
+	MathMacro          string
+	Diagrams           map[string]r.Diagram
+	DiagramCache       string
+	Toc                *TocConfig
+	Header             string
+	Footer             string
+	IndexFiles         []string
+	FolderTemplate     string
+	OrderPages         bool
+	TitleCollision     string
+	MaxRetries         *int
+	Timeout            *Duration
+	Proxy              string
+	CACerts            []string
+	ClientCert         string
+	ClientKey          string
+	InsecureSkipVerify bool
+}
+
+// Duration is a time.Duration written as a string such as "90s" in .confluence.json
+type Duration time.Duration
+
+// UnmarshalJSON parses the duration with time.ParseDuration
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"90s\": %s", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
 }
 
 func (conf *ConfluenceConfig) LoadConfig() error {
@@ -45,9 +88,70 @@ func (conf *ConfluenceConfig) LoadConfig() error {
 func (conf *ConfluenceConfig) SetConfig(m *Markdown2Confluence) {
 	m.Username = conf.Username
 	m.Password = conf.Password
+	m.Token = conf.Token
+	m.Auth = conf.Auth
+	if conf.Flavor != "" {
+		m.Flavor = conf.Flavor
+	}
+	if conf.API != "" {
+		m.API = conf.API
+	}
 	m.Endpoint = conf.Endpoint
 	m.Space = conf.Space
 	m.Parent = conf.Parent
 	m.GitSyncDir = conf.GitSyncDir
 	m.Model = conf.Model
+	if conf.StateFile != "" {
+		m.StateFile = conf.StateFile
+	}
+	if conf.OnConflict != "" {
+		m.OnConflict = conf.OnConflict
+	}
+	if conf.MathMacro != "" {
+		m.MathMacro = conf.MathMacro
+	}
+	if len(conf.Diagrams) > 0 {
+		m.Diagrams = conf.Diagrams
+	}
+	if conf.DiagramCache != "" {
+		m.DiagramCache = conf.DiagramCache
+	}
+	if conf.Toc != nil {
+		m.Toc = *conf.Toc
+	}
+	m.Header = conf.Header
+	m.Footer = conf.Footer
+	if len(conf.IndexFiles) > 0 {
+		m.IndexFiles = conf.IndexFiles
+	}
+	if conf.FolderTemplate != "" {
+		m.FolderTemplate = conf.FolderTemplate
+	}
+	if conf.OrderPages {
+		m.OrderPages = true
+	}
+	if conf.TitleCollision != "" {
+		m.TitleCollision = conf.TitleCollision
+	}
+	if conf.MaxRetries != nil {
+		m.MaxRetries = *conf.MaxRetries
+	}
+	if conf.Timeout != nil {
+		m.Timeout = time.Duration(*conf.Timeout)
+	}
+	if conf.Proxy != "" {
+		m.Proxy = conf.Proxy
+	}
+	if len(conf.CACerts) > 0 {
+		m.CACerts = conf.CACerts
+	}
+	if conf.ClientCert != "" {
+		m.ClientCert = conf.ClientCert
+	}
+	if conf.ClientKey != "" {
+		m.ClientKey = conf.ClientKey
+	}
+	if conf.InsecureSkipVerify {
+		m.InsecureSkipVerify = true
+	}
 }
@@ -0,0 +1,155 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/justmiles/go-confluence"
+)
+
+// Policies for pages that were edited in Confluence since they were last published
+const (
+	ConflictFail      = "fail"
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+)
+
+// errConflictSkipped is returned by Upload when a page edited in Confluence is left alone
+var errConflictSkipped = fmt.Errorf("page was edited in Confluence")
+
+// maxDiffLines caps the size of the bodies compared when printing a conflict
+const maxDiffLines = 2000
+
+// checkConflict compares the version of the existing page with the version
+// recorded when f was last published. If somebody else changed the page in
+// the meantime, the --on-conflict policy decides whether it is overwritten.
+func (f *MarkdownFile) checkConflict(m *Markdown2Confluence, existing confluence.Content) error {
+	e, ok := f.manifestEntry(m)
+	if !ok || e.PageID != existing.ID || e.Version == 0 || existing.Version.Number <= e.Version {
+		return nil
+	}
+
+	version, err := m.client.GetVersion(existing.ID)
+	if err != nil {
+		return fmt.Errorf("Error reading version of page %s: %s", existing.ID, err)
+	}
+	me, err := m.client.CurrentUser()
+	if err != nil {
+		return fmt.Errorf("Error reading current user: %s", err)
+	}
+	if version.By.Is(me) {
+		return nil
+	}
+
+	// Ticking tasks is what Confluence is for, and does not conflict with the markdown
+	var published *confluence.Content
+	if m.onConflict() != ConflictOverwrite {
+		published, err = m.client.GetHistoricalContent(existing.ID, e.Version)
+		if err != nil && m.Debug {
+			fmt.Printf("unable to read version %d of page %s: %s\n", e.Version, existing.ID, err)
+		}
+		if published != nil && normalizeStorage(withoutTaskStatus(published.Body.Storage.Value)) == normalizeStorage(withoutTaskStatus(existing.Body.Storage.Value)) {
+			return nil
+		}
+	}
+
+	author := version.By.DisplayName
+	if author == "" {
+		author = version.By.Username
+	}
+	summary := fmt.Sprintf("page %s was edited in Confluence by %s (version %d, last published version %d)", existing.ID, author, version.Number, e.Version)
+
+	if m.DryRun {
+		m.Plan.Add(PlanAction{Kind: PlanConflict, Title: f.Title, Path: f.Path, Detail: summary + ", --on-conflict=" + m.onConflict()})
+		if m.onConflict() == ConflictOverwrite {
+			return nil
+		}
+		return errConflictSkipped
+	}
+
+	switch m.onConflict() {
+	case ConflictOverwrite:
+		fmt.Printf("覆盖远程修改：%s %s\n", f.Path, summary)
+		return nil
+	case ConflictSkip:
+		fmt.Printf("跳过：%s %s\n", f.Path, summary)
+		atomic.AddInt32(&m.conflicts, 1)
+		return errConflictSkipped
+	}
+
+	diff := ""
+	if published != nil {
+		diff = "\n" + storageDiff(published.Body.Storage.Value, existing.Body.Storage.Value, e.Version, version.Number)
+	}
+	return fmt.Errorf("%s, use --force or --on-conflict=overwrite to replace it%s", summary, diff)
+}
+
+// onConflict returns the --on-conflict policy, taking --force into account
+func (m *Markdown2Confluence) onConflict() string {
+	if m.Force {
+		return ConflictOverwrite
+	}
+	if m.OnConflict == "" {
+		return ConflictFail
+	}
+	return m.OnConflict
+}
+
+// storageDiff returns a line based diff of two storage format bodies. Tags
+// are put on lines of their own, as storage format is mostly a single line.
+func storageDiff(published, remote string, publishedVersion, remoteVersion int) string {
+	a := storageLines(published)
+	b := storageLines(remote)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\t--- version %d (last published)\n\t+++ version %d (Confluence)\n", publishedVersion, remoteVersion)
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		fmt.Fprintf(&sb, "\t(%d lines -> %d lines, too large to compare)\n", len(a), len(b))
+		return sb.String()
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&sb, "\t- %s\n", a[i])
+			i++
+		default:
+			fmt.Fprintf(&sb, "\t+ %s\n", b[j])
+			j++
+		}
+	}
+	return sb.String()
+}
+
+// storageLines splits a storage format body into one line per tag
+func storageLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.Replace(normalizeStorage(s), "><", ">\n<", -1), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
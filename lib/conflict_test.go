@@ -0,0 +1,170 @@
+package lib
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStorageDiff(t *testing.T) {
+	const header = "\t--- version 2 (last published)\n\t+++ version 3 (Confluence)\n"
+
+	tests := []struct {
+		name      string
+		published string
+		remote    string
+		diff      string
+	}{
+		{
+			name:      "no edits",
+			published: "<h1>Title</h1><p>text</p>",
+			remote:    "<h1>Title</h1>\n<p>text</p>",
+			diff:      header,
+		},
+		{
+			name:      "changed line",
+			published: "<h1>Title</h1><p>text</p>",
+			remote:    "<h1>Title</h1><p>edited</p>",
+			diff:      header + "\t- <p>text</p>\n\t+ <p>edited</p>\n",
+		},
+		{
+			name:      "added line",
+			published: "<p>one</p><p>three</p>",
+			remote:    "<p>one</p><p>two</p><p>three</p>",
+			diff:      header + "\t+ <p>two</p>\n",
+		},
+		{
+			name:      "removed lines",
+			published: "<p>one</p><p>two</p><p>three</p>",
+			remote:    "<p>three</p>",
+			diff:      header + "\t- <p>one</p>\n\t- <p>two</p>\n",
+		},
+		{
+			name:      "macro IDs are ignored",
+			published: `<ac:structured-macro ac:name="info"><ac:rich-text-body><p>x</p></ac:rich-text-body></ac:structured-macro>`,
+			remote:    `<ac:structured-macro ac:name="info" ac:macro-id="1"><ac:rich-text-body><p>x</p></ac:rich-text-body></ac:structured-macro>`,
+			diff:      header,
+		},
+		{
+			name:      "too large to compare",
+			published: strings.Repeat("<p>x</p>", maxDiffLines+1),
+			remote:    "<p>x</p>",
+			diff:      header + fmt.Sprintf("\t(%d lines -> 1 lines, too large to compare)\n", maxDiffLines+1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := storageDiff(tt.published, tt.remote, 2, 3); diff != tt.diff {
+				t.Errorf("diff = %q, want %q", diff, tt.diff)
+			}
+		})
+	}
+}
+
+func TestCheckConflict(t *testing.T) {
+	const published = "<p>published</p><ac:task-list><ac:task><ac:task-id>1</ac:task-id><ac:task-status>incomplete</ac:task-status><ac:task-body>t</ac:task-body></ac:task></ac:task-list>"
+	me := `{"accountId":"me","displayName":"Me"}`
+
+	tests := []struct {
+		name          string
+		version       int
+		body          string
+		author        string
+		onConflict    string
+		err           string
+		skipped       bool
+		historyLoaded bool
+	}{
+		{
+			name:    "no edits",
+			version: 2,
+			body:    published,
+		},
+		{
+			name:    "edited by this user",
+			version: 3,
+			body:    "<p>edited</p>",
+			author:  me,
+		},
+		{
+			name:          "only tasks ticked by another user",
+			version:       3,
+			body:          strings.Replace(published, "incomplete", "complete", 1),
+			author:        `{"accountId":"other","displayName":"Other"}`,
+			historyLoaded: true,
+		},
+		{
+			name:          "edited by another user",
+			version:       3,
+			body:          "<p>edited</p>",
+			author:        `{"accountId":"other","displayName":"Other"}`,
+			err:           "page 42 was edited in Confluence by Other (version 3, last published version 2)",
+			historyLoaded: true,
+		},
+		{
+			name:          "edited by another user and skipped",
+			version:       3,
+			body:          "<p>edited</p>",
+			author:        `{"accountId":"other","displayName":"Other"}`,
+			onConflict:    ConflictSkip,
+			skipped:       true,
+			historyLoaded: true,
+		},
+		{
+			name:       "edited by another user and overwritten",
+			version:    3,
+			body:       "<p>edited</p>",
+			author:     `{"accountId":"other","displayName":"Other"}`,
+			onConflict: ConflictOverwrite,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var historyLoaded bool
+			mux := http.NewServeMux()
+			mux.HandleFunc("/rest/api/user/current", func(w http.ResponseWriter, req *http.Request) {
+				w.Write([]byte(me))
+			})
+			mux.HandleFunc("/rest/api/content/42", func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Query().Get("status") == "historical" {
+					historyLoaded = true
+					w.Write([]byte(`{"id":"42","body":{"storage":{"value":"` + published + `"}}}`))
+					return
+				}
+				w.Write([]byte(`{"id":"42","version":{"number":3,"by":` + tt.author + `}}`))
+			})
+			client, server := newTestClient(mux)
+			defer server.Close()
+
+			m := Markdown2Confluence{client: client, manifest: emptyManifest(), OnConflict: tt.onConflict}
+			f := MarkdownFile{Path: "docs/page.md", Title: "page"}
+			m.manifest.Set(f.Path, ManifestEntry{PageID: "42", Version: 2})
+			existing := testPage("42", "page")
+			existing.Version.Number = tt.version
+			existing.Body.Storage.Value = tt.body
+
+			err := f.checkConflict(&m, existing)
+			switch {
+			case tt.skipped:
+				if err != errConflictSkipped {
+					t.Errorf("err = %v, want the page skipped", err)
+				}
+			case tt.err != "":
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("err = %v, want %q", err, tt.err)
+				}
+				if err != nil && !strings.Contains(err.Error(), "\t+ <p>edited</p>") {
+					t.Errorf("err = %v, want the diff of the edit", err)
+				}
+			case err != nil:
+				t.Errorf("unexpected error: %s", err)
+			}
+			if historyLoaded != tt.historyLoaded {
+				t.Errorf("published version loaded: %v, want %v", historyLoaded, tt.historyLoaded)
+			}
+		})
+	}
+}
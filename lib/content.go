@@ -0,0 +1,218 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/justmiles/go-confluence"
+
+	r "markdownToConfluence/lib/renderer"
+)
+
+// The methods below replace those of go-confluence, which ignores the
+// status of responses, logs errors instead of returning them and can not be
+// retried, with the same methods on request.
+
+// GetContent returns the content matching the query
+func (client *Client) GetContent(qp *confluence.GetContentQueryParameters) ([]confluence.Content, error) {
+	params := url.Values{}
+	if len(qp.Expand) > 0 {
+		params.Set("expand", strings.Join(qp.Expand, ","))
+	}
+	if qp.Status != "" {
+		params.Set("status", qp.Status)
+	}
+	if qp.Limit > 0 {
+		params.Set("limit", fmt.Sprint(qp.Limit))
+	}
+	if qp.Start > 0 {
+		params.Set("start", fmt.Sprint(qp.Start))
+	}
+	if qp.Orderby != "" {
+		params.Set("orderby", qp.Orderby)
+	}
+	if qp.PostingDay != "" {
+		params.Set("postingDay", qp.PostingDay)
+	}
+	if qp.Spacekey != "" {
+		params.Set("spaceKey", qp.Spacekey)
+	}
+	if qp.Title != "" {
+		params.Set("title", qp.Title)
+	}
+	if qp.Trigger != "" {
+		params.Set("trigger", qp.Trigger)
+	}
+	if qp.Type != "" {
+		params.Set("type", qp.Type)
+	}
+
+	var response confluence.ContentResponse
+	if err := client.request("GET", "/rest/api/content", params, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Results, nil
+}
+
+// contentParams returns the query parameters of qp
+func contentParams(qp *confluence.QueryParameters) url.Values {
+	params := url.Values{}
+	if qp == nil {
+		return params
+	}
+	if len(qp.Expand) > 0 {
+		params.Set("expand", strings.Join(qp.Expand, ","))
+	}
+	if qp.Status != "" {
+		params.Set("status", qp.Status)
+	}
+	return params
+}
+
+// CreateContent creates a new page
+func (client *Client) CreateContent(bp *confluence.CreateContentBodyParameters, qp *confluence.QueryParameters) (confluence.Content, error) {
+	if client.API == APIv2 {
+		return client.v2CreateContent(bp)
+	}
+	var content confluence.Content
+	err := client.request("POST", "/rest/api/content", contentParams(qp), bp, &content)
+	return content, err
+}
+
+// UpdateContent updates the title, body or parent of a page
+func (client *Client) UpdateContent(content *confluence.Content, qp *confluence.QueryParameters) (confluence.Content, error) {
+	if client.API == APIv2 {
+		return client.v2UpdateContent(content)
+	}
+	var updated confluence.Content
+	if err := client.request("PUT", "/rest/api/content/"+content.ID, contentParams(qp), content, &updated); err != nil {
+		return *content, err
+	}
+	return updated, nil
+}
+
+// DeleteContent moves a page to the trash of its space
+func (client *Client) DeleteContent(content confluence.Content) error {
+	if client.API == APIv2 {
+		return client.v2DeleteContent(content)
+	}
+	return client.request("DELETE", "/rest/api/content/"+content.ID, nil, nil, nil)
+}
+
+// AddLabels adds labels to a page
+func (client *Client) AddLabels(contentID string, labels []string, prefix confluence.LabelPrefix) error {
+	type label struct {
+		Prefix string `json:"prefix"`
+		Name   string `json:"name"`
+	}
+	var payload []label
+	for _, l := range labels {
+		payload = append(payload, label{string(prefix), l})
+	}
+	return client.request("POST", "/rest/api/content/"+contentID+"/label", nil, payload, nil)
+}
+
+// attachmentEndpoint returns the endpoint of the attachments of a page
+func attachmentEndpoint(contentID string) string {
+	return "/rest/api/content/" + contentID + "/child/attachment"
+}
+
+// GetAttachmentByFilename returns the attachment of a page with the given
+// file name, or an error if there is none
+func (client *Client) GetAttachmentByFilename(contentID, filename string) (*confluence.Attachment, error) {
+	if client.API == APIv2 {
+		return client.v2GetAttachmentByFilename(contentID, filename)
+	}
+	params := url.Values{}
+	params.Set("filename", filename)
+
+	var attachments confluence.Attachments
+	if err := client.request("GET", attachmentEndpoint(contentID), params, nil, &attachments); err != nil {
+		return nil, err
+	}
+	if len(attachments.Results) < 1 {
+		return nil, fmt.Errorf("attachment %s not found", filename)
+	}
+	return &attachments.Results[0], nil
+}
+
+// AddUpdateAttachments uploads files to a page, as new versions of the
+// attachments of the same name where those exist. Confluence Cloud does
+// both in one request, Data Center needs the attachment looked up first.
+func (client *Client) AddUpdateAttachments(contentID string, files []string) ([]*confluence.Attachment, []error) {
+	var results []*confluence.Attachment
+	var errors []error
+	for _, f := range files {
+		method, endpoint, update := "PUT", attachmentEndpoint(contentID), true
+		if client.Flavor == r.FlavorDataCenter {
+			method, update = "POST", false
+			existing, err := client.GetAttachmentByFilename(contentID, path.Base(f))
+			if err == nil {
+				endpoint += "/" + existing.ID + "/data"
+				update = true
+			} else if apiErr, ok := err.(*APIError); ok {
+				errors = append(errors, apiErr)
+				continue
+			}
+		}
+
+		attachment, err := client.uploadAttachment(method, endpoint, f, update)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("Error uploading %s: %s", f, err))
+			continue
+		}
+		results = append(results, attachment)
+	}
+	return results, errors
+}
+
+// uploadAttachment sends the file p to endpoint, which adds an attachment
+// or, with update, a new version of it as a minor edit
+func (client *Client) uploadAttachment(method, endpoint, p string, update bool) (*confluence.Attachment, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filepath.Base(p))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(part, file); err != nil {
+		return nil, err
+	}
+	if update {
+		if err = writer.WriteField("minorEdit", "true"); err != nil {
+			return nil, err
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	// The data endpoint of an attachment returns the attachment, the others a list
+	var raw json.RawMessage
+	if err := client.send(method, endpoint, nil, writer.FormDataContentType(), body.Bytes(), &raw); err != nil {
+		return nil, err
+	}
+	var attachments confluence.Attachments
+	if err := json.Unmarshal(raw, &attachments); err == nil && len(attachments.Results) > 0 {
+		return &attachments.Results[0], nil
+	}
+	var attachment confluence.Attachment
+	if err := json.Unmarshal(raw, &attachment); err != nil || attachment.ID == "" {
+		return nil, fmt.Errorf("unexpected response %s", raw)
+	}
+	return &attachment, nil
+}
@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+
+	r "markdownToConfluence/lib/renderer"
+)
+
+// DefaultDiagramCache is where converted diagrams are kept unless --diagram-cache says otherwise
+const DefaultDiagramCache = ".confluence-diagrams"
+
+// diagramConfig returns the diagram languages and cache passed to the renderer
+func (m *Markdown2Confluence) diagramConfig() r.DiagramConfig {
+	cacheDir := m.DiagramCache
+	if cacheDir == "" {
+		cacheDir = DefaultDiagramCache
+	}
+	return r.DiagramConfig{Languages: m.Diagrams, CacheDir: cacheDir, DryRun: m.DryRun}
+}
+
+// isConvertedDiagram reports whether image is a diagram from the diagram
+// cache. Its file name contains the hash of the diagram source, so an
+// attachment with the same name already has the same contents.
+func (m *Markdown2Confluence) isConvertedDiagram(image string) bool {
+	cacheDir, err := filepath.Abs(m.diagramConfig().CacheDir)
+	if err != nil {
+		return false
+	}
+	return filepath.Dir(image) == cacheDir
+}
+
+// uploadAttachments adds or updates the images of a page. Converted diagrams
+// that are already attached are not uploaded again.
+func (m *Markdown2Confluence) uploadAttachments(contentID string, images []string) []error {
+	var uploads []string
+	for _, image := range images {
+		if m.isConvertedDiagram(image) {
+			if _, err := m.client.GetAttachmentByFilename(contentID, path.Base(image)); err == nil {
+				continue
+			}
+		}
+		uploads = append(uploads, image)
+	}
+	_, errors := m.client.AddUpdateAttachments(contentID, uploads)
+	return errors
+}
+
+// validateDiagrams checks the configured diagram languages
+func (m *Markdown2Confluence) validateDiagrams() error {
+	for lang, d := range m.Diagrams {
+		if d.Macro == "" && d.Command == "" {
+			return fmt.Errorf("diagram language %s needs a Macro or a Command", lang)
+		}
+		if d.Command != "" {
+			args, err := d.Args()
+			if err != nil {
+				return fmt.Errorf("diagram language %s: %s", lang, err)
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("diagram language %s: Command is blank", lang)
+			}
+		}
+		switch d.Format {
+		case "", "svg", "png":
+		default:
+			return fmt.Errorf("diagram language %s: Format must be svg or png", lang)
+		}
+	}
+	return nil
+}
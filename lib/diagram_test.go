@@ -0,0 +1,35 @@
+package lib
+
+import (
+	"testing"
+
+	r "markdownToConfluence/lib/renderer"
+)
+
+func TestValidateDiagrams(t *testing.T) {
+	tests := []struct {
+		name    string
+		diagram r.Diagram
+		err     bool
+	}{
+		{name: "macro", diagram: r.Diagram{Macro: "drawio"}},
+		{name: "command", diagram: r.Diagram{Command: `mmdc -i {input} -o "out file.svg"`}},
+		{name: "neither", diagram: r.Diagram{}, err: true},
+		{name: "blank command", diagram: r.Diagram{Macro: "plantuml", Command: "  "}, err: true},
+		{name: "unterminated quote", diagram: r.Diagram{Command: `dot "-Tsvg`}, err: true},
+		{name: "unknown format", diagram: r.Diagram{Command: "dot", Format: "gif"}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Markdown2Confluence{Diagrams: map[string]r.Diagram{"lang": tt.diagram}}
+			err := m.validateDiagrams()
+			if tt.err && err == nil {
+				t.Errorf("expected an error")
+			}
+			if !tt.err && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
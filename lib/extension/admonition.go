@@ -0,0 +1,139 @@
+package extension
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+
+	cast "markdownToConfluence/lib/extension/ast"
+)
+
+// gitHubAlert matches the first line of a GitHub alert blockquote, e.g. "[!NOTE] Optional title"
+var gitHubAlert = regexp.MustCompile(`^\[!(NOTE|TIP|IMPORTANT|WARNING|CAUTION)\][ \t]*(.*?)[ \t]*$`)
+
+// mkDocsAdmonition matches the opening line of a MkDocs admonition, e.g. `!!! note "Title"`
+var mkDocsAdmonition = regexp.MustCompile(`^!!![ \t]+([A-Za-z][\w-]*)(?:[ \t]+"(.*)")?[ \t]*$`)
+
+type admonitionTransformer struct {
+}
+
+// NewAdmonitionTransformer returns a parser.ASTTransformer that turns
+// GitHub alert blockquotes into Admonition nodes.
+func NewAdmonitionTransformer() parser.ASTTransformer {
+	return &admonitionTransformer{}
+}
+
+// Transform implements parser.ASTTransformer.Transform.
+func (t *admonitionTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var blockquotes []*ast.Blockquote
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if b, ok := n.(*ast.Blockquote); ok && entering {
+			blockquotes = append(blockquotes, b)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, b := range blockquotes {
+		para, ok := b.FirstChild().(*ast.Paragraph)
+		if !ok || para.Lines().Len() == 0 {
+			continue
+		}
+		marker := para.Lines().At(0)
+		match := gitHubAlert.FindSubmatch(bytes.TrimRight(marker.Value(source), "\r\n"))
+		if match == nil {
+			continue
+		}
+
+		// Drop the inlines of the marker line, whatever their type, the rest
+		// of the paragraph stays. The title is their plain text, so markup
+		// in it is neither shown raw nor repeated in the body.
+		var line bytes.Buffer
+		for c := para.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			line.Write(c.Text(source))
+			para.RemoveChild(para, c)
+			if t, ok := c.(*ast.Text); ok && (t.SoftLineBreak() || t.HardLineBreak()) {
+				break
+			}
+			c = next
+		}
+		title := match[2]
+		if plain := gitHubAlert.FindSubmatch(line.Bytes()); plain != nil {
+			title = plain[2]
+		}
+		admonition := cast.NewAdmonition(strings.ToLower(string(match[1])), title)
+		if para.ChildCount() == 0 {
+			b.RemoveChild(b, para)
+		}
+
+		for c := b.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			admonition.AppendChild(admonition, c)
+			c = next
+		}
+		b.Parent().ReplaceChild(b.Parent(), b, admonition)
+	}
+}
+
+type admonitionParser struct {
+}
+
+// NewAdmonitionParser returns a parser.BlockParser that parses MkDocs
+// admonitions: a `!!! type "Title"` line followed by content indented by
+// four spaces.
+func NewAdmonitionParser() parser.BlockParser {
+	return &admonitionParser{}
+}
+
+func (b *admonitionParser) Trigger() []byte {
+	return []byte{'!'}
+}
+
+func (b *admonitionParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, _ := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 {
+		return nil, parser.NoChildren
+	}
+	match := mkDocsAdmonition.FindSubmatch(bytes.TrimRight(line[pos:], "\r\n"))
+	if match == nil {
+		return nil, parser.NoChildren
+	}
+
+	node := cast.NewAdmonition(strings.ToLower(string(match[1])), match[2])
+	reader.Advance(len(bytes.TrimRight(line, "\r\n")))
+	return node, parser.HasChildren
+}
+
+func (b *admonitionParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, _ := reader.PeekLine()
+	if util.IsBlank(line) {
+		return parser.Continue | parser.HasChildren
+	}
+
+	pos, padding := util.IndentPosition(line, reader.LineOffset(), 4)
+	if pos < 0 {
+		return parser.Close
+	}
+	reader.AdvanceAndSetPadding(pos, padding)
+	return parser.Continue | parser.HasChildren
+}
+
+func (b *admonitionParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+	// nothing to do
+}
+
+func (b *admonitionParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (b *admonitionParser) CanAcceptIndentedLine() bool {
+	return false
+}
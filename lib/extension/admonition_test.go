@@ -0,0 +1,78 @@
+package extension
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark"
+
+	r "markdownToConfluence/lib/renderer"
+)
+
+// render converts src with the Confluence extension
+func render(t *testing.T, src string, extensions ...goldmark.Extender) string {
+	md := goldmark.New(goldmark.WithExtensions(append(extensions, NewConfluenceExtension("", nil, r.DiagramConfig{}, r.FlavorCloud))...))
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(src), &buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestGitHubAlertTitle(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		title string
+		body  string
+	}{
+		{
+			name: "no title",
+			src:  "> [!NOTE]\n> body text\n",
+			body: "<p>body text</p>",
+		},
+		{
+			name:  "plain title",
+			src:   "> [!TIP] Read this\n> body text\n",
+			title: "Read this",
+			body:  "<p>body text</p>",
+		},
+		{
+			name:  "emphasis in the title",
+			src:   "> [!NOTE] **Bold title**\n> body text\n",
+			title: "Bold title",
+			body:  "<p>body text</p>",
+		},
+		{
+			name:  "code and link in the title",
+			src:   "> [!WARNING] Run `make` or [see](x.html)\n> body text\n",
+			title: "Run make or see",
+			body:  "<p>body text</p>",
+		},
+		{
+			name:  "marker line only",
+			src:   "> [!CAUTION] *Careful*\n",
+			title: "Careful",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := render(t, tt.src)
+			title := `<ac:parameter ac:name="title">` + tt.title + `</ac:parameter>`
+			if tt.title != "" && !strings.Contains(out, title) {
+				t.Errorf("missing %s in\n%s", title, out)
+			}
+			if tt.title == "" && strings.Contains(out, `ac:name="title"`) {
+				t.Errorf("unexpected title in\n%s", out)
+			}
+			if tt.body != "" && !strings.Contains(out, tt.body) {
+				t.Errorf("missing body %s in\n%s", tt.body, out)
+			}
+			if tt.title != "" && strings.Count(out, tt.title) != 1 {
+				t.Errorf("title repeated in\n%s", out)
+			}
+		})
+	}
+}
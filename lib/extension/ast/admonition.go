@@ -0,0 +1,42 @@
+// Package ast defines the AST nodes of the Confluence markdown extensions
+package ast
+
+import (
+	gast "github.com/yuin/goldmark/ast"
+)
+
+// An Admonition struct represents a call-out block such as a GitHub
+// "> [!NOTE]" blockquote or a MkDocs "!!! note" block.
+type Admonition struct {
+	gast.BaseBlock
+
+	// AdmonitionType is the lower case type of the admonition, e.g. "note" or "warning"
+	AdmonitionType string
+
+	// Title is the optional title shown above the content
+	Title []byte
+}
+
+// Dump implements Node.Dump.
+func (n *Admonition) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{
+		"AdmonitionType": n.AdmonitionType,
+		"Title":          string(n.Title),
+	}, nil)
+}
+
+// KindAdmonition is a NodeKind of the Admonition node.
+var KindAdmonition = gast.NewNodeKind("Admonition")
+
+// Kind implements Node.Kind.
+func (n *Admonition) Kind() gast.NodeKind {
+	return KindAdmonition
+}
+
+// NewAdmonition returns a new Admonition node.
+func NewAdmonition(admonitionType string, title []byte) *Admonition {
+	return &Admonition{
+		AdmonitionType: admonitionType,
+		Title:          title,
+	}
+}
@@ -0,0 +1,64 @@
+package ast
+
+import (
+	gast "github.com/yuin/goldmark/ast"
+)
+
+// A MathBlock struct represents a display formula, written between `$$`
+// lines or in a ```math fence. The formula is kept in the lines of the block.
+type MathBlock struct {
+	gast.BaseBlock
+}
+
+// IsRaw implements Node.IsRaw.
+func (n *MathBlock) IsRaw() bool {
+	return true
+}
+
+// Dump implements Node.Dump.
+func (n *MathBlock) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, nil, nil)
+}
+
+// KindMathBlock is a NodeKind of the MathBlock node.
+var KindMathBlock = gast.NewNodeKind("MathBlock")
+
+// Kind implements Node.Kind.
+func (n *MathBlock) Kind() gast.NodeKind {
+	return KindMathBlock
+}
+
+// NewMathBlock returns a new MathBlock node.
+func NewMathBlock() *MathBlock {
+	return &MathBlock{}
+}
+
+// An InlineMath struct represents a formula written between single `$`.
+type InlineMath struct {
+	gast.BaseInline
+
+	// Formula is the LaTeX source without the dollar signs
+	Formula []byte
+}
+
+// Dump implements Node.Dump.
+func (n *InlineMath) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{
+		"Formula": string(n.Formula),
+	}, nil)
+}
+
+// KindInlineMath is a NodeKind of the InlineMath node.
+var KindInlineMath = gast.NewNodeKind("InlineMath")
+
+// Kind implements Node.Kind.
+func (n *InlineMath) Kind() gast.NodeKind {
+	return KindInlineMath
+}
+
+// NewInlineMath returns a new InlineMath node.
+func NewInlineMath(formula []byte) *InlineMath {
+	return &InlineMath{
+		Formula: formula,
+	}
+}
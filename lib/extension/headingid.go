@@ -0,0 +1,54 @@
+package extension
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+)
+
+type headingIDs struct {
+	values map[string]bool
+}
+
+// NewHeadingIDs returns a parser.IDs that generates heading IDs the way
+// GitHub does, so that `#fragment` links written against GitHub keep
+// working. Unlike the goldmark default, letters outside ASCII such as CJK
+// are kept.
+func NewHeadingIDs() parser.IDs {
+	return &headingIDs{
+		values: map[string]bool{},
+	}
+}
+
+// Generate implements parser.IDs.Generate.
+func (s *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	var sb strings.Builder
+	for _, c := range strings.ToLower(strings.TrimSpace(string(value))) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsNumber(c) || unicode.IsMark(c) || c == '-' || c == '_':
+			sb.WriteRune(c)
+		case c == ' ':
+			sb.WriteByte('-')
+		}
+	}
+	id := sb.String()
+	if id == "" {
+		id = "heading"
+	}
+
+	// Later headings with the same text get -1, -2, ... appended
+	result := id
+	for i := 1; s.values[result]; i++ {
+		result = id + "-" + strconv.Itoa(i)
+	}
+	s.values[result] = true
+	return []byte(result)
+}
+
+// Put implements parser.IDs.Put.
+func (s *headingIDs) Put(value []byte) {
+	s.values[string(value)] = true
+}
@@ -0,0 +1,86 @@
+package extension
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+)
+
+func TestHeadingIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		put      []string
+		headings []string
+		ids      []string
+	}{
+		{
+			name:     "ASCII",
+			headings: []string{"Hello World", "  Getting Started: v2.0  ", "snake_case and kebab-case"},
+			ids:      []string{"hello-world", "getting-started-v20", "snake_case-and-kebab-case"},
+		},
+		{
+			name:     "CJK",
+			headings: []string{"安装指南", "第 2 步：配置", "日本語の見出し", "한국어 제목"},
+			ids:      []string{"安装指南", "第-2-步配置", "日本語の見出し", "한국어-제목"},
+		},
+		{
+			name:     "accents and marks",
+			headings: []string{"Café Déjà Vu", "हिन्दी"},
+			ids:      []string{"café-déjà-vu", "हिन्दी"},
+		},
+		{
+			name:     "duplicates",
+			headings: []string{"Usage", "Usage", "usage", "用法", "用法"},
+			ids:      []string{"usage", "usage-1", "usage-2", "用法", "用法-1"},
+		},
+		{
+			name:     "duplicate of a numbered heading",
+			headings: []string{"Step 1", "Step", "Step"},
+			ids:      []string{"step-1", "step", "step-2"},
+		},
+		{
+			name:     "empty headings",
+			headings: []string{"", "!!!", "？"},
+			ids:      []string{"heading", "heading-1", "heading-2"},
+		},
+		{
+			name:     "explicit IDs are not reused",
+			put:      []string{"intro"},
+			headings: []string{"Intro"},
+			ids:      []string{"intro-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := NewHeadingIDs()
+			for _, id := range tt.put {
+				ids.Put([]byte(id))
+			}
+			var got []string
+			for _, heading := range tt.headings {
+				got = append(got, string(ids.Generate([]byte(heading), ast.KindHeading)))
+			}
+			if !reflect.DeepEqual(got, tt.ids) {
+				t.Errorf("ids = %q, want %q", got, tt.ids)
+			}
+		})
+	}
+}
+
+func TestHeadingIDsInDocument(t *testing.T) {
+	md := goldmark.New(goldmark.WithParserOptions(parser.WithAutoHeadingID()))
+	var buf bytes.Buffer
+	ctx := parser.NewContext(parser.WithIDs(NewHeadingIDs()))
+	if err := md.Convert([]byte("# 概述\n\n## 概述\n\n## ???\n"), &buf, parser.WithContext(ctx)); err != nil {
+		t.Fatal(err)
+	}
+	want := `<h1 id="概述">概述</h1>` + "\n" + `<h2 id="概述-1">概述</h2>` + "\n" + `<h2 id="heading">???</h2>` + "\n"
+	if buf.String() != want {
+		t.Errorf("html = %q, want %q", buf.String(), want)
+	}
+}
@@ -2,6 +2,7 @@ package extension
 
 import (
 	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer"
 	"github.com/yuin/goldmark/util"
 
@@ -11,28 +12,55 @@ import (
 // Confluence is a Goldmark extension that renders markdown content compatable with Confluence
 type Confluence struct {
 	imageHTMLRender *r.ConfluenceImageHTMLRender
+	linkHTMLRender  *r.ConfluenceLinkHTMLRender
+	codeHTMLRender  *r.ConfluenceFencedCodeBlockHTMLRender
 }
 
-// NewConfluenceExtension returns an instanciated instance of Confluence
-func NewConfluenceExtension(filePath string) *Confluence {
+// NewConfluenceExtension returns an instanciated instance of Confluence.
+// resolve maps links to other markdown files to the pages they are published to,
+// diagrams configures how fences of diagram languages are rendered and
+// flavor is the Confluence the content is rendered for.
+func NewConfluenceExtension(filePath string, resolve r.PageResolver, diagrams r.DiagramConfig, flavor string) *Confluence {
 	c := &Confluence{
 		imageHTMLRender: r.NewConfluenceImageHTMLRender(filePath),
+		linkHTMLRender:  r.NewConfluenceLinkHTMLRender(filePath, resolve),
+		codeHTMLRender:  r.NewConfluenceFencedCodeBlockHTMLRender(filePath, diagrams),
 	}
+	c.codeHTMLRender.Flavor = flavor
 	return c
 }
 
-// Images returns a slice of image paths for later upload
+// Images returns a slice of image paths for later upload, including converted diagrams
 func (c *Confluence) Images() []string {
-	return c.imageHTMLRender.Images
+	return append(c.imageHTMLRender.Images, c.codeHTMLRender.Images...)
+}
+
+// Warnings returns the problems found while rendering, such as links to
+// markdown files outside the sync set
+func (c *Confluence) Warnings() []string {
+	return c.linkHTMLRender.Warnings
 }
 
 // Extend markdown custom HTML render
 func (c *Confluence) Extend(m goldmark.Markdown) {
 
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(
+			util.Prioritized(NewAdmonitionParser(), 100),
+		),
+		parser.WithASTTransformers(
+			util.Prioritized(NewAdmonitionTransformer(), 100),
+		),
+	)
+
 	m.Renderer().AddOptions(renderer.WithNodeRenderers(
-		util.Prioritized(r.NewConfluenceFencedCodeBlockHTMLRender(), 100),
+		util.Prioritized(c.codeHTMLRender, 100),
 		util.Prioritized(r.NewConfluenceCodeBlockHTMLRender(), 100),
 		util.Prioritized(c.imageHTMLRender, 100),
+		util.Prioritized(c.linkHTMLRender, 100),
+		util.Prioritized(r.NewConfluenceAdmonitionHTMLRender(), 100),
+		util.Prioritized(r.NewConfluenceTaskListHTMLRender(), 100),
+		util.Prioritized(r.NewConfluenceHeadingHTMLRender(), 100),
 	))
 
 }
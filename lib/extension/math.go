@@ -0,0 +1,222 @@
+package extension
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+
+	cast "markdownToConfluence/lib/extension/ast"
+	r "markdownToConfluence/lib/renderer"
+)
+
+// Math is a Goldmark extension that renders `$...$` and `$$...$$` formulas,
+// and ```math fences, as Confluence math macros
+type Math struct {
+	macro string
+}
+
+// NewMathExtension returns a Math extension rendering formulas with macro,
+// renderer.MathMacro or renderer.LatexMacro.
+func NewMathExtension(macro string) *Math {
+	return &Math{macro: macro}
+}
+
+// Extend markdown with math parsers and the math macro render
+func (e *Math) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(
+			util.Prioritized(NewMathBlockParser(), 150),
+		),
+		parser.WithInlineParsers(
+			util.Prioritized(NewInlineMathParser(), 150),
+		),
+		parser.WithASTTransformers(
+			util.Prioritized(NewMathFenceTransformer(), 100),
+		),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(r.NewConfluenceMathHTMLRender(e.macro), 100),
+	))
+}
+
+// mathBlockClosedKey holds the MathBlock that was opened and closed on a single `$$ ... $$` line
+var mathBlockClosedKey = parser.NewContextKey()
+
+type mathBlockParser struct {
+}
+
+// NewMathBlockParser returns a parser.BlockParser that parses display
+// formulas between `$$` lines, or on a single `$$ ... $$` line.
+func NewMathBlockParser() parser.BlockParser {
+	return &mathBlockParser{}
+}
+
+func (b *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (b *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+
+	// Text after an opening `$$` that does not end the formula on the same
+	// line is more likely prose about money than a formula
+	node := cast.NewMathBlock()
+	start := segment.Start + pos + 2
+	rest := bytes.TrimRight(line[pos+2:], " \t\r\n")
+	if len(rest) >= 2 && bytes.HasSuffix(rest, []byte("$$")) {
+		node.Lines().Append(text.NewSegment(start, start+len(rest)-2))
+		pc.Set(mathBlockClosedKey, node)
+	} else if len(rest) > 0 {
+		return nil, parser.NoChildren
+	}
+	return node, parser.NoChildren
+}
+
+func (b *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	if pc.Get(mathBlockClosedKey) == node {
+		return parser.Close
+	}
+
+	line, segment := reader.PeekLine()
+	trimmed := bytes.TrimRight(line, " \t\r\n")
+	if bytes.HasSuffix(trimmed, []byte("$$")) {
+		if !util.IsBlank(trimmed[:len(trimmed)-2]) {
+			node.Lines().Append(text.NewSegment(segment.Start, segment.Start+len(trimmed)-2))
+		}
+		reader.Advance(len(trimmed))
+		return parser.Close
+	}
+
+	node.Lines().Append(segment)
+	reader.Advance(segment.Len() - 1)
+	return parser.Continue | parser.NoChildren
+}
+
+func (b *mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+	if pc.Get(mathBlockClosedKey) == node {
+		pc.Set(mathBlockClosedKey, nil)
+	}
+}
+
+func (b *mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (b *mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+type inlineMathParser struct {
+}
+
+// NewInlineMathParser returns a parser.InlineParser that parses formulas
+// between single dollar signs. As in Pandoc, the opening `$` must be
+// followed and the closing `$` preceded by a non-space character, and the
+// closing `$` must not be followed by a digit, so that amounts such as
+// "$5 and $10" are left alone. Formulas do not span code spans. A formula
+// between double dollar signs within a paragraph is an inline formula as
+// well.
+func NewInlineMathParser() parser.InlineParser {
+	return &inlineMathParser{}
+}
+
+func (s *inlineMathParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (s *inlineMathParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	if len(line) > 1 && line[1] == '$' {
+		return parseDisplayInlineMath(block, line, segment)
+	}
+	if len(line) < 3 || util.IsSpace(line[1]) {
+		return nil
+	}
+
+	for i := 2; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			// An escaped dollar sign does not close the formula
+			i++
+		case '`':
+			// Dollars in code spans are left alone
+			return nil
+		case '$':
+			if util.IsSpace(line[i-1]) || (i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9') {
+				continue
+			}
+			formula := append([]byte{}, line[1:i]...)
+			block.Advance(i + 1)
+			return cast.NewInlineMath(formula)
+		}
+	}
+	return nil
+}
+
+// parseDisplayInlineMath parses a $$...$$ formula within a line. Without a
+// closing $$ both dollar signs are kept as text, so that the second one does
+// not open a formula of its own.
+func parseDisplayInlineMath(block text.Reader, line []byte, segment text.Segment) ast.Node {
+	if end := displayInlineMathEnd(line); end > 0 {
+		block.Advance(end + 2)
+		return cast.NewInlineMath(append([]byte{}, bytes.TrimSpace(line[2:end])...))
+	}
+	block.Advance(2)
+	return ast.NewTextSegment(segment.WithStop(segment.Start + 2))
+}
+
+// displayInlineMathEnd returns the position of the $$ closing the formula
+// line starts with, or 0 if it is not closed or empty
+func displayInlineMathEnd(line []byte) int {
+	for i := 2; i+1 < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '`':
+			return 0
+		case '$':
+			if line[i+1] != '$' || len(bytes.TrimSpace(line[2:i])) == 0 {
+				return 0
+			}
+			return i
+		}
+	}
+	return 0
+}
+
+type mathFenceTransformer struct {
+}
+
+// NewMathFenceTransformer returns a parser.ASTTransformer that turns
+// ```math fences into MathBlock nodes.
+func NewMathFenceTransformer() parser.ASTTransformer {
+	return &mathFenceTransformer{}
+}
+
+// Transform implements parser.ASTTransformer.Transform.
+func (t *mathFenceTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var fences []*ast.FencedCodeBlock
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if f, ok := n.(*ast.FencedCodeBlock); ok && entering && string(f.Language(source)) == "math" {
+			fences = append(fences, f)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, f := range fences {
+		math := cast.NewMathBlock()
+		math.SetLines(f.Lines())
+		f.Parent().ReplaceChild(f.Parent(), f, math)
+	}
+}
@@ -0,0 +1,63 @@
+package extension
+
+import (
+	"testing"
+
+	r "markdownToConfluence/lib/renderer"
+)
+
+func TestInlineMath(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		html string
+	}{
+		{
+			name: "single dollars",
+			src:  "Inline $c$ mid line\n",
+			html: `<p>Inline <ac:structured-macro ac:name="mathinline" ac:schema-version="1"><ac:parameter ac:name="body">c</ac:parameter></ac:structured-macro> mid line</p>` + "\n",
+		},
+		{
+			name: "double dollars within a paragraph",
+			src:  "Inline $$c$$ mid line\n",
+			html: `<p>Inline <ac:structured-macro ac:name="mathinline" ac:schema-version="1"><ac:parameter ac:name="body">c</ac:parameter></ac:structured-macro> mid line</p>` + "\n",
+		},
+		{
+			name: "unclosed double dollars",
+			src:  "a $$ b\n",
+			html: "<p>a $$ b</p>\n",
+		},
+		{
+			name: "empty double dollars",
+			src:  "a $$ $$ b\n",
+			html: "<p>a $$ $$ b</p>\n",
+		},
+		{
+			name: "amounts",
+			src:  "$5 and $10\n",
+			html: "<p>$5 and $10</p>\n",
+		},
+		{
+			name: "double dollars on their own line",
+			src:  "$$x$$\n",
+			html: `<ac:structured-macro ac:name="mathblock" ac:schema-version="1"><ac:plain-text-body><![CDATA[x]]></ac:plain-text-body></ac:structured-macro>` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if html := render(t, tt.src, NewMathExtension("")); html != tt.html {
+				t.Errorf("html = %q, want %q", html, tt.html)
+			}
+		})
+	}
+}
+
+func TestMathCodeMacro(t *testing.T) {
+	html := render(t, "Inline $a<b$ text\n\n$$\nx^2\n$$\n", NewMathExtension(r.CodeMacro))
+	want := "<p>Inline <code>a&lt;b</code> text</p>\n" +
+		`<ac:structured-macro ac:name="code" ac:schema-version="1"><ac:parameter ac:name="language">none</ac:parameter><ac:plain-text-body><![CDATA[x^2]]></ac:plain-text-body></ac:structured-macro>` + "\n"
+	if html != want {
+		t.Errorf("html = %q, want %q", html, want)
+	}
+}
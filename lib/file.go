@@ -2,8 +2,10 @@ package lib
 
 import (
 	"fmt"
-	"io/ioutil"
+	"os"
+	"path"
 	"strings"
+	"sync"
 
 	"github.com/justmiles/go-confluence"
 )
@@ -14,12 +16,27 @@ type MarkdownFile struct {
 	Title    string
 	Parents  []string
 	Ancestor string
+	Space    string
+	Meta     FrontMatter
+	// RenamedFrom is the previous path of a renamed file, whose page is reused
+	RenamedFrom string
+	// parentDirs are the folders of the last Parents, which are derived from the location of the file
+	parentDirs []string
+	root       string
 }
 
 func (f *MarkdownFile) String() (urlPath string) {
 	return fmt.Sprintf("Path: %s, Title: %s, Parent: %s, Ancestor: %s", f.Path, f.Title, f.Parents, f.Ancestor)
 }
 
+// space returns the key of the space the page of f belongs in
+func (f *MarkdownFile) space(m *Markdown2Confluence) string {
+	if f.Space != "" {
+		return f.Space
+	}
+	return m.Space
+}
+
 // FormattedPath returns the Path with Parents
 func (f *MarkdownFile) FormattedPath() (s string) {
 	s = strings.Join(append(f.Parents, f.Title), "/")
@@ -32,7 +49,7 @@ func (f *MarkdownFile) FormattedPath() (s string) {
 func (f *MarkdownFile) Upload(m *Markdown2Confluence) (urlPath string, err error) {
 	var ancestorID string
 	// Content of Wiki
-	dat, err := ioutil.ReadFile(f.Path)
+	_, wikiContent, err := m.readMarkdownFile(f.Path)
 	if err != nil {
 		return urlPath, fmt.Errorf("Could not open file %s:\n\t%s", f.Path, err)
 	}
@@ -41,9 +58,8 @@ func (f *MarkdownFile) Upload(m *Markdown2Confluence) (urlPath string, err error
 		fmt.Println(f.Path)
 	}
 
-	wikiContent := string(dat)
 	var images []string
-	wikiContent, images, err = renderContent(f.Path, wikiContent, m.WithHardWraps)
+	wikiContent, images, err = m.renderContent(f, wikiContent)
 
 	if err != nil {
 		return urlPath, fmt.Errorf("unable to render content from %s: %s", f.Path, err)
@@ -59,35 +75,80 @@ func (f *MarkdownFile) Upload(m *Markdown2Confluence) (urlPath string, err error
 		}
 	}
 
+	if len(f.Parents) > 0 {
+		ancestorID, err = f.FindOrCreateAncestors(m)
+		if err != nil {
+			return urlPath, err
+		}
+		f.Ancestor = ancestorID
+	}
+
 	// search for existing page
-	contentResults, err := m.client.GetContent(&confluence.GetContentQueryParameters{
-		Title:    f.Title,
-		Spacekey: m.Space,
-		Limit:    1,
-		Type:     "page",
-		Expand:   []string{"version", "body.storage"},
-	})
+	existing, err := f.findUploadPage(m, []string{"version", "body.storage", "ancestors"})
 	if err != nil {
 		return urlPath, fmt.Errorf("Error checking for existing page: %s", err)
 	}
 
-	if len(f.Parents) > 0 {
-		ancestorID, err = f.FindOrCreateAncestors(m)
-		if err != nil {
+	if existing != nil {
+		wikiContent = keepTaskStatus(wikiContent, existing.Body.Storage.Value)
+	}
+
+	fingerprint, err := pageFingerprint(wikiContent, images, f.metadata())
+	if err != nil {
+		return urlPath, fmt.Errorf("unable to read attachments of %s: %s", f.Path, err)
+	}
+
+	if existing != nil && f.unchanged(m, *existing, ancestorID, wikiContent, fingerprint) {
+		if m.DryRun {
+			return urlPath, errUnchanged
+		}
+		// The body is identical, but attachments, labels and properties may
+		// still have changed if the page was not published with this fingerprint before
+		if e, ok := f.manifestEntry(m); !ok || e.Hash != fingerprint {
+			errors := m.uploadAttachments(existing.ID, images)
+			if len(errors) > 0 {
+				fmt.Println(errors)
+				return urlPath, errors[0]
+			}
+			if err = f.applyMetadata(m, existing.ID); err != nil {
+				return urlPath, err
+			}
+		}
+		f.record(m, *existing, ancestorID, fingerprint)
+		return urlPath, errUnchanged
+	}
+
+	if existing != nil {
+		if err = f.checkConflict(m, *existing); err != nil {
 			return urlPath, err
 		}
 	}
 
+	if m.DryRun {
+		if existing != nil {
+			f.planUpdate(m, *existing, ancestorID)
+			f.planAttachments(m, existing.ID, images)
+		} else {
+			f.planCreate(m, ancestorID)
+			f.planAttachments(m, "", images)
+		}
+		f.planMetadata(m)
+		return urlPath, nil
+	}
+
 	var content confluence.Content
 	var currContentID string
 	// if page exists, update it
-	if len(contentResults) > 0 {
-		content = contentResults[0]
+	if existing != nil {
+		content = *existing
+		content.Title = f.Title
 		content.Version.Number++
 		content.Version.Message = m.Comment
 		content.Body.Storage.Representation = "storage"
 		content.Body.Storage.Value = wikiContent
-		content.Space.Key = m.Space
+		content.Space.Key = f.space(m)
+		// Only the direct parent is sent back, the full chain was expanded for the plan
+		content.Ancestors = nil
 		if ancestorID != "" {
 			content.Ancestors = append(content.Ancestors, Ancestor{
 				ID: ancestorID,
@@ -98,8 +159,9 @@ func (f *MarkdownFile) Upload(m *Markdown2Confluence) (urlPath string, err error
 		if err != nil {
 			return urlPath, fmt.Errorf("Error updating content: %s", err)
 		}
-		urlPath = m.client.Endpoint + content.Links.Tinyui
+		urlPath = m.pageURL(content)
 		currContentID = content.ID
+		f.record(m, content, ancestorID, fingerprint)
 
 		// if page does not exist, create it
 	} else {
@@ -107,7 +169,7 @@ func (f *MarkdownFile) Upload(m *Markdown2Confluence) (urlPath string, err error
 		bp := confluence.CreateContentBodyParameters{}
 		bp.Title = f.Title
 		bp.Type = "page"
-		bp.Space.Key = m.Space
+		bp.Space.Key = f.space(m)
 		bp.Body.Storage.Representation = "storage"
 		bp.Body.Storage.Value = wikiContent
 
@@ -121,24 +183,34 @@ func (f *MarkdownFile) Upload(m *Markdown2Confluence) (urlPath string, err error
 		if err != nil {
 			return urlPath, fmt.Errorf("Error creating page: %s", err)
 		}
-		urlPath = m.client.Endpoint + content.Links.Tinyui
+		urlPath = m.pageURL(content)
 		currContentID = content.ID
+		f.record(m, content, ancestorID, fingerprint)
 	}
 
-	_, errors := m.client.AddUpdateAttachments(currContentID, images)
+	errors := m.uploadAttachments(currContentID, images)
 	if len(errors) > 0 {
 		fmt.Println(errors)
 		err = errors[0]
 	}
 
+	if metaErr := f.applyMetadata(m, currContentID); metaErr != nil && err == nil {
+		err = metaErr
+	}
+
 	return urlPath, err
 }
 
 // FindOrCreateAncestors creates an empty page to represent a local "folder" name
 func (f *MarkdownFile) FindOrCreateAncestors(m *Markdown2Confluence) (ancestorID string, err error) {
 
-	for _, parent := range f.Parents {
-		ancestorID, err = f.FindOrCreateAncestor(m, m.client, ancestorID, parent)
+	offset := len(f.Parents) - len(f.parentDirs)
+	for i := range f.Parents {
+		var dir string
+		if i >= offset {
+			dir = f.parentDirs[i-offset]
+		}
+		ancestorID, err = f.FindOrCreateAncestor(m, m.client, ancestorID, f.Parents[:i+1], dir)
 		if err != nil {
 			return "", err
 		}
@@ -152,7 +224,7 @@ func (f *MarkdownFile) FindOrCreateAncestors(m *Markdown2Confluence) (ancestorID
 func (f *MarkdownFile) AddPage(m *Markdown2Confluence) (urlPath string, err error) {
 	var ancestorID string
 	// Content of Wiki
-	dat, err := ioutil.ReadFile(f.Path)
+	_, wikiContent, err := m.readMarkdownFile(f.Path)
 	if err != nil {
 		return urlPath, fmt.Errorf("Could not open file %s:\n\t%s", f.Path, err)
 	}
@@ -161,9 +233,8 @@ func (f *MarkdownFile) AddPage(m *Markdown2Confluence) (urlPath string, err erro
 		fmt.Println(f.Path)
 	}
 
-	wikiContent := string(dat)
 	var images []string
-	wikiContent, images, err = renderContent(f.Path, wikiContent, m.WithHardWraps)
+	wikiContent, images, err = m.renderContent(f, wikiContent)
 
 	if err != nil {
 		return urlPath, fmt.Errorf("unable to render content from %s: %s", f.Path, err)
@@ -179,35 +250,40 @@ func (f *MarkdownFile) AddPage(m *Markdown2Confluence) (urlPath string, err erro
 		}
 	}
 
-	// search for existing page
-	contentResults, err := m.client.GetContent(&confluence.GetContentQueryParameters{
-		Title:    f.Title,
-		Spacekey: m.Space,
-		Limit:    1,
-		Type:     "page",
-		Expand:   []string{"version", "body.storage"},
-	})
-	if err != nil {
-		return urlPath, fmt.Errorf("Error checking for existing page: %s", err)
-	}
-
 	if len(f.Parents) > 0 {
 		ancestorID, err = f.FindOrCreateAncestors(m)
 		if err != nil {
 			return urlPath, err
 		}
+		f.Ancestor = ancestorID
+	}
+
+	// search for existing page
+	existing, err := f.findUploadPage(m, []string{"version"})
+	if err != nil {
+		return urlPath, fmt.Errorf("Error checking for existing page: %s", err)
+	}
+
+	fingerprint, err := pageFingerprint(wikiContent, images, f.metadata())
+	if err != nil {
+		return urlPath, fmt.Errorf("unable to read attachments of %s: %s", f.Path, err)
 	}
 
 	var currContentID string
 	// if page exists, 则不进行创建
-	if len(contentResults) > 0 {
+	if existing != nil {
 		return urlPath, fmt.Errorf("已存在同名文件：%s.md", f.Title)
 		// if page does not exist, create it
+	} else if m.DryRun {
+		f.planCreate(m, ancestorID)
+		f.planAttachments(m, "", images)
+		f.planMetadata(m)
+		return urlPath, nil
 	} else {
 		bp := confluence.CreateContentBodyParameters{}
 		bp.Title = f.Title
 		bp.Type = "page"
-		bp.Space.Key = m.Space
+		bp.Space.Key = f.space(m)
 		bp.Body.Storage.Representation = "storage"
 		bp.Body.Storage.Value = wikiContent
 
@@ -221,86 +297,304 @@ func (f *MarkdownFile) AddPage(m *Markdown2Confluence) (urlPath string, err erro
 		if err != nil {
 			return urlPath, fmt.Errorf("Error creating page: %s", err)
 		}
-		urlPath = m.client.Endpoint + content.Links.Tinyui
+		urlPath = m.pageURL(content)
 		currContentID = content.ID
+		f.record(m, content, ancestorID, fingerprint)
 	}
 
-	_, errors := m.client.AddUpdateAttachments(currContentID, images)
+	errors := m.uploadAttachments(currContentID, images)
 	if len(errors) > 0 {
 		fmt.Println(errors)
 		err = errors[0]
 	}
 
+	if metaErr := f.applyMetadata(m, currContentID); metaErr != nil && err == nil {
+		err = metaErr
+	}
+
 	return urlPath, err
 }
 
 // DeletePage 删除一个页面
 func (f *MarkdownFile) DeletePage(m *Markdown2Confluence) (urlPath string, err error) {
 	// search for existing page
-	contentResults, err := m.client.GetContent(&confluence.GetContentQueryParameters{
-		Title:    f.Title,
-		Spacekey: m.Space,
-		Limit:    1,
-		Type:     "page",
-		Expand:   []string{"version", "body.storage"},
-	})
+	existing, err := f.findPage(m, nil)
 	if err != nil {
 		return urlPath, fmt.Errorf("Error checking for existing page: %s", err)
 	}
 
 	var content confluence.Content
 	// if page exists, delete it
-	if len(contentResults) > 0 {
-		content = contentResults[0]
+	if existing != nil {
+		content = *existing
+		if m.DryRun {
+			m.Plan.Add(PlanAction{Kind: PlanDelete, Title: content.Title, Path: f.Path, Detail: "page " + content.ID})
+			return urlPath, nil
+		}
 		err = m.client.DeleteContent(content)
 		if err != nil {
 			return urlPath, fmt.Errorf("Error delete page fail: %s", err)
 		}
 	}
+	if !m.DryRun {
+		m.manifest.Delete(f.Path)
+	}
 
 	return urlPath, nil
 }
 
+// findPage looks up the page f was published to, to delete or reset it. A
+// page found by its title is used unless the manifest ties it to another file.
+func (f *MarkdownFile) findPage(m *Markdown2Confluence, expand []string) (*confluence.Content, error) {
+	content, searched, err := f.lookupPage(m, expand)
+	if err != nil || content == nil || !searched {
+		return content, err
+	}
+	if owner := m.manifest.Owner(content.ID); owner != "" && owner != manifestKey(f.Path) {
+		return nil, nil
+	}
+	return content, nil
+}
+
+// findUploadPage looks up the page f is published to. The page of another
+// file is not taken over, and a page found by its title elsewhere in the
+// space only when the manifest ties it to this file. Otherwise it belongs to
+// another repository or was made by hand, and is neither overwritten nor
+// moved, but handled by the collision strategy.
+func (f *MarkdownFile) findUploadPage(m *Markdown2Confluence, expand []string) (*confluence.Content, error) {
+	content, searched, err := f.lookupPage(m, expand)
+	if err != nil || content == nil || !searched {
+		return content, err
+	}
+
+	var parentID string
+	if len(content.Ancestors) > 0 {
+		parentID = content.Ancestors[len(content.Ancestors)-1].ID
+	}
+	owner := m.manifest.Owner(content.ID)
+	if owner == manifestKey(f.Path) || (owner == "" && parentID == f.Ancestor) {
+		return content, nil
+	}
+	title, err := m.remoteCollision(m.pageSources(*f)[0], f.space(m), *content)
+	if err != nil {
+		return nil, err
+	}
+	f.Title = title
+	if isPageID(f.Ancestor) {
+		return m.findChildPage(f.space(m), f.Title, f.Ancestor, expand)
+	}
+	return nil, nil
+}
+
+// lookupPage looks up the page f was published to. The page recorded in the
+// manifest is used when it still exists, otherwise the page is searched by
+// title. searched reports whether the page was found by its title anywhere
+// in the space, so that the caller decides whether it may be used.
+func (f *MarkdownFile) lookupPage(m *Markdown2Confluence, expand []string) (content *confluence.Content, searched bool, err error) {
+	if f.Meta.PageID != "" {
+		content, err := m.client.GetContentByID(f.Meta.PageID, expand)
+		if err == nil && content == nil {
+			err = fmt.Errorf("page_id %s of %s does not exist", f.Meta.PageID, f.Path)
+		}
+		return content, false, err
+	}
+
+	if e, ok := m.manifest.Get(f.Path); ok {
+		content, err := m.client.GetContentByID(e.PageID, expand)
+		if err != nil {
+			return nil, false, err
+		}
+		if content != nil {
+			return content, false, nil
+		}
+		if m.Debug {
+			fmt.Printf("page %s recorded for %s no longer exists\n", e.PageID, f.Path)
+		}
+	}
+
+	// A renamed file keeps the page of its previous path, which carries the old title
+	if f.RenamedFrom != "" {
+		previous := m.deletedMarkdownFile(f.RenamedFrom)
+		previous.Space = f.Space
+		content, err := previous.findPage(m, expand)
+		if err != nil || content != nil {
+			return content, false, err
+		}
+	}
+
+	// The page is expected below its parent page, but may have been moved
+	if isPageID(f.Ancestor) {
+		content, err := m.findChildPage(f.space(m), f.Title, f.Ancestor, expand)
+		if err != nil || content != nil {
+			return content, false, err
+		}
+	}
+	content, err = m.findSpacePage(f.space(m), f.Title, append(expand[:len(expand):len(expand)], "ancestors"))
+	return content, content != nil, err
+}
+
+// record stores the page f was published to in the manifest. The entry of
+// the previous path of a renamed file is dropped only now, so that a failed
+// upload leaves the page to the next run.
+func (f *MarkdownFile) record(m *Markdown2Confluence, content confluence.Content, ancestorID, fingerprint string) {
+	if f.RenamedFrom != "" {
+		m.manifest.Delete(f.RenamedFrom)
+	}
+	m.manifest.Set(f.Path, ManifestEntry{
+		PageID:   content.ID,
+		Title:    f.Title,
+		ParentID: ancestorID,
+		Hash:     fingerprint,
+		Version:  content.Version.Number,
+	})
+}
+
+// manifestEntry returns the entry recorded for f. A renamed file finds it
+// under its previous path until it is published.
+func (f *MarkdownFile) manifestEntry(m *Markdown2Confluence) (ManifestEntry, bool) {
+	if e, ok := m.manifest.Get(f.Path); ok || f.RenamedFrom == "" {
+		return e, ok
+	}
+	return m.manifest.Get(f.RenamedFrom)
+}
+
+// errUnchanged is returned by Upload when the page is already up to date
+var errUnchanged = fmt.Errorf("page is unchanged")
+
+// unchanged reports whether the existing page already has the title, parent
+// and body f would publish. The body is compared against the fingerprint
+// stored in the manifest when nobody edited the page since, and against the
+// normalized remote body otherwise.
+func (f *MarkdownFile) unchanged(m *Markdown2Confluence, existing confluence.Content, ancestorID, wikiContent, fingerprint string) bool {
+	if existing.Title != f.Title {
+		return false
+	}
+	if ancestorID != "" {
+		if len(existing.Ancestors) == 0 || existing.Ancestors[len(existing.Ancestors)-1].ID != ancestorID {
+			return false
+		}
+	}
+
+	if e, ok := f.manifestEntry(m); ok && e.PageID == existing.ID && e.Version == existing.Version.Number && e.Hash == fingerprint {
+		return true
+	}
+
+	return normalizeStorage(existing.Body.Storage.Value) == normalizeStorage(wikiContent)
+}
+
 // ParentIndex caches parent page Ids for futures reference
 var ParentIndex = make(map[string]string)
 
-// FindOrCreateAncestor creates an empty page to represent a local "folder" name
-func (f *MarkdownFile) FindOrCreateAncestor(m *Markdown2Confluence, client *confluence.Client, ancestorID, parent string) (string, error) {
-	if parent == "" {
+// parentIndexMu guards ParentIndex, which the upload workers fill as well
+var parentIndexMu sync.Mutex
+
+// cachedParent returns the ID of the parent page cached under key
+func cachedParent(key string) (string, bool) {
+	parentIndexMu.Lock()
+	defer parentIndexMu.Unlock()
+	id, ok := ParentIndex[key]
+	return id, ok
+}
+
+// cacheParent caches the ID of the parent page under key and returns it
+func cacheParent(key, id string) string {
+	parentIndexMu.Lock()
+	defer parentIndexMu.Unlock()
+	ParentIndex[key] = id
+	return id
+}
+
+// FindOrCreateAncestor creates a page to represent a local "folder" name,
+// the last of parents. The page is cached by its full path and looked up
+// below ancestorID, so that a folder of the same name elsewhere in the space
+// is not mistaken for it. dir is the folder, if the page stands for one: a
+// folder with an index file gets the page of that file, other folders get
+// a Confluence folder with the v2 API and the folder template otherwise.
+func (f *MarkdownFile) FindOrCreateAncestor(m *Markdown2Confluence, client *Client, ancestorID string, parents []string, dir string) (string, error) {
+	if len(parents) == 0 || parents[len(parents)-1] == "" {
 		return "", nil
 	}
+	parent := parents[len(parents)-1]
 
-	if val, ok := ParentIndex[parent]; ok {
+	parentKey := f.space(m) + ":" + strings.Join(parents, "/")
+	if val, ok := cachedParent(parentKey); ok {
 		return val, nil
 	}
 
 	if m.Debug {
-		fmt.Printf("Searching for parent %s\n", parent)
+		fmt.Printf("Searching for parent %s\n", strings.Join(parents, "/"))
 	}
 
-	contentResults, err := client.GetContent(&confluence.GetContentQueryParameters{
-		Title:    parent,
-		Spacekey: m.Space,
-		Limit:    1,
-		Type:     "page",
-	})
+	// A folder without an index file becomes a Confluence folder, unless an
+	// earlier sync already created a page for it
+	folder := dir != "" && m.useFolders() && m.folderIndexFile(dir) == ""
+
+	existing, err := m.findAncestor(f.space(m), parent, ancestorID, folder)
 	if err != nil {
 		return "", fmt.Errorf("Error checking for parent page: %s", err)
 	}
 
-	if len(contentResults) > 0 {
-		content := contentResults[0]
-		ParentIndex[parent] = content.ID
-		return content.ID, err
+	// A page of the same title elsewhere in the space can not be created again
+	if existing == nil && ancestorID != "" {
+		other, err := m.findSpacePage(f.space(m), parent, []string{"ancestors"})
+		if err != nil {
+			return "", fmt.Errorf("Error checking for parent page: %s", err)
+		}
+		if other != nil {
+			source := titleSource{path: dir, root: f.root, title: parent}
+			if dir == "" {
+				source.path = strings.Join(parents, "/")
+			}
+			if len(parents) > 1 {
+				source.parent = parents[len(parents)-2]
+			}
+			if parent, err = m.remoteCollision(source, f.space(m), *other); err != nil {
+				return "", err
+			}
+			if isPageID(ancestorID) {
+				if existing, err = m.findAncestor(f.space(m), parent, ancestorID, folder); err != nil {
+					return "", fmt.Errorf("Error checking for parent page: %s", err)
+				}
+			}
+		}
+	}
+
+	if existing != nil {
+		return cacheParent(parentKey, existing.ID), nil
+	}
+
+	if index := m.folderIndexFile(dir); index != "" && index != f.Path {
+		id, err := f.createFolderFromIndex(m, index, parent)
+		if err != nil {
+			return "", err
+		}
+		return cacheParent(parentKey, id), nil
+	}
+
+	if folder {
+		if m.DryRun {
+			m.Plan.Add(PlanAction{Kind: PlanCreateFolder, Title: parent, Path: f.Path, Detail: "under " + describeParent(ancestorID)})
+			return cacheParent(parentKey, dryRunID(parent)), nil
+		}
+		content, err := client.CreateFolder(f.space(m), parent, ancestorID)
+		if err != nil {
+			return "", fmt.Errorf("Error creating folder %s for %s: %s", parent, f.Path, err)
+		}
+		return cacheParent(parentKey, content.ID), nil
+	}
+
+	body, err := m.folderPageBody(parent, dir)
+	if err != nil {
+		return "", err
 	}
 
 	// if parent page does not exist, create it
 	bp := confluence.CreateContentBodyParameters{}
 	bp.Title = parent
 	bp.Type = "page"
-	bp.Space.Key = m.Space
+	bp.Space.Key = f.space(m)
 	bp.Body.Storage.Representation = "storage"
-	bp.Body.Storage.Value = defaultAncestorPage
+	bp.Body.Storage.Value = body
 
 	if m.Debug {
 		fmt.Printf("Creating parent page '%s' with ancestor id %s\n", bp.Title, ancestorID)
@@ -312,12 +606,122 @@ func (f *MarkdownFile) FindOrCreateAncestor(m *Markdown2Confluence, client *conf
 		})
 	}
 
+	if m.DryRun {
+		m.Plan.Add(PlanAction{Kind: PlanCreateParent, Title: parent, Path: f.Path, Detail: "under " + describeParent(ancestorID)})
+		return cacheParent(parentKey, dryRunID(parent)), nil
+	}
+
 	content, err := client.CreateContent(&bp, nil)
 	if err != nil {
 		return "", fmt.Errorf("Error creating parent page %s for %s: %s", f.Path, bp.Title, err)
 	}
-	ParentIndex[parent] = content.ID
-	return content.ID, nil
+	return cacheParent(parentKey, content.ID), nil
+}
+
+// planCreate records the creation of the page for f
+func (f *MarkdownFile) planCreate(m *Markdown2Confluence, ancestorID string) {
+	m.Plan.Add(PlanAction{Kind: PlanCreate, Title: f.Title, Path: f.Path, Detail: "under " + describeParent(ancestorID)})
+}
+
+// planUpdate records the update of an existing page, and its rename and move
+// when the title or parent page changes
+func (f *MarkdownFile) planUpdate(m *Markdown2Confluence, content confluence.Content, ancestorID string) {
+	m.Plan.Add(PlanAction{
+		Kind:   PlanUpdate,
+		Title:  f.Title,
+		Path:   f.Path,
+		Detail: fmt.Sprintf("page %s, version %d -> %d", content.ID, content.Version.Number, content.Version.Number+1),
+	})
+
+	if content.Title != f.Title {
+		m.Plan.Add(PlanAction{
+			Kind:   PlanRename,
+			Title:  f.Title,
+			Path:   f.Path,
+			Detail: "from " + content.Title,
+		})
+	}
+
+	var currentParent string
+	if len(content.Ancestors) > 0 {
+		currentParent = content.Ancestors[len(content.Ancestors)-1].ID
+	}
+	if ancestorID != "" && ancestorID != currentParent {
+		m.Plan.Add(PlanAction{
+			Kind:   PlanMove,
+			Title:  f.Title,
+			Path:   f.Path,
+			Detail: "from " + describeParent(currentParent) + " to " + describeParent(ancestorID),
+		})
+	}
+}
+
+// planAttachments records the upload of the local images referenced by f.
+// contentID is empty when the page itself does not exist yet.
+func (f *MarkdownFile) planAttachments(m *Markdown2Confluence, contentID string, images []string) {
+	for _, image := range images {
+		if m.isConvertedDiagram(image) {
+			// Diagrams are not converted in a dry run unless they are cached
+			if _, err := os.Stat(image); err != nil {
+				m.Plan.Add(PlanAction{Kind: PlanConvert, Title: path.Base(image), Path: image, Detail: "diagram on " + f.Title})
+			}
+		}
+		detail := "new"
+		if contentID != "" {
+			if _, err := m.client.GetAttachmentByFilename(contentID, path.Base(image)); err == nil {
+				if m.isConvertedDiagram(image) {
+					continue
+				}
+				detail = "new version"
+			}
+		}
+		m.Plan.Add(PlanAction{Kind: PlanAttach, Title: path.Base(image), Path: image, Detail: detail + " on " + f.Title})
+	}
+}
+
+func describeParent(ancestorID string) string {
+	if ancestorID == "" {
+		return "space root"
+	}
+	if strings.HasPrefix(ancestorID, dryRunPrefix) {
+		return "new page " + strings.TrimPrefix(ancestorID, dryRunPrefix)
+	}
+	return "page " + ancestorID
+}
+
+// pageMetadata is the part of the front matter that is stored next to the page body
+type pageMetadata struct {
+	Labels     []string               `json:"labels,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+func (f *MarkdownFile) metadata() pageMetadata {
+	return pageMetadata{Labels: f.Meta.Labels, Properties: f.Meta.Properties}
+}
+
+// applyMetadata adds the labels and content properties from the front matter to the page
+func (f *MarkdownFile) applyMetadata(m *Markdown2Confluence, contentID string) error {
+	if len(f.Meta.Labels) > 0 {
+		if err := m.client.AddLabels(contentID, f.Meta.Labels, confluence.GlobalPrefix); err != nil {
+			return fmt.Errorf("Error adding labels to %s: %s", f.Title, err)
+		}
+	}
+	for key, value := range f.Meta.Properties {
+		if err := m.client.SetContentProperty(contentID, key, value); err != nil {
+			return fmt.Errorf("Error setting property %s on %s: %s", key, f.Title, err)
+		}
+	}
+	return nil
+}
+
+// planMetadata records the labels and content properties that would be set
+func (f *MarkdownFile) planMetadata(m *Markdown2Confluence) {
+	if len(f.Meta.Labels) > 0 {
+		m.Plan.Add(PlanAction{Kind: PlanLabel, Title: f.Title, Path: f.Path, Detail: strings.Join(f.Meta.Labels, ", ")})
+	}
+	for key := range f.Meta.Properties {
+		m.Plan.Add(PlanAction{Kind: PlanProperty, Title: f.Title, Path: f.Path, Detail: key})
+	}
 }
 
 // Ancestor TODO: move this to go-confluence api
@@ -0,0 +1,133 @@
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/justmiles/go-confluence"
+)
+
+// newTestClient returns a Client talking to a Confluence served by handler.
+// The caller closes the returned server.
+func newTestClient(handler http.Handler) (*Client, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	return NewClient(server.URL, bearerAuth{token: "token"}, false, server.Client()), server
+}
+
+// writeJSON answers a request of the test server with v encoded as JSON
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// titleSearch serves the title search of pages with pages, keyed by title
+func titleSearch(pages map[string]confluence.Content) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var response confluence.ContentResponse
+		if page, ok := pages[req.URL.Query().Get("title")]; ok {
+			response.Results = append(response.Results, page)
+		}
+		writeJSON(w, response)
+	}
+}
+
+// testPage returns the page id titled title below the pages ancestors
+func testPage(id, title string, ancestors ...string) confluence.Content {
+	content := confluence.Content{ID: id, Title: title}
+	for _, ancestor := range ancestors {
+		content.Ancestors = append(content.Ancestors, Ancestor{ID: ancestor})
+	}
+	return content
+}
+
+// emptyManifest returns a manifest that has not recorded any page yet
+func emptyManifest() *Manifest {
+	return &Manifest{Pages: make(map[string]ManifestEntry)}
+}
+
+func TestDeletePageBelowParent(t *testing.T) {
+	tests := []struct {
+		name    string
+		owner   string
+		deleted bool
+	}{
+		{name: "page not in the manifest", deleted: true},
+		{name: "page of the file", owner: "docs/guide.md", deleted: true},
+		{name: "page of another file", owner: "docs/other.md"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deleted []string
+			mux := http.NewServeMux()
+			mux.Handle("/rest/api/content", titleSearch(map[string]confluence.Content{
+				"guide": testPage("42", "guide", "1", "7"),
+			}))
+			mux.HandleFunc("/rest/api/content/", func(w http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodDelete {
+					deleted = append(deleted, strings.TrimPrefix(req.URL.Path, "/rest/api/content/"))
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				http.NotFound(w, req)
+			})
+			client, server := newTestClient(mux)
+			defer server.Close()
+
+			manifest := emptyManifest()
+			if tt.owner != "" {
+				manifest.Pages[tt.owner] = ManifestEntry{PageID: "42", Title: "guide"}
+			}
+			m := Markdown2Confluence{Space: "DOCS", client: client, manifest: manifest}
+
+			// Deleted files are not rendered, so the parent page is not resolved
+			f := m.deletedMarkdownFile("docs/guide.md")
+			if _, err := f.DeletePage(&m); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tt.deleted != (len(deleted) == 1 && deleted[0] == "42") {
+				t.Errorf("deleted %v, want page 42 deleted: %v", deleted, tt.deleted)
+			}
+		})
+	}
+}
+
+func TestFindUploadPageRenamed(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/rest/api/content", titleSearch(map[string]confluence.Content{
+		"old": testPage("42", "old", "1", "7"),
+	}))
+	client, server := newTestClient(mux)
+	defer server.Close()
+
+	m := Markdown2Confluence{Space: "DOCS", client: client, manifest: emptyManifest()}
+	f := MarkdownFile{Path: "docs/new.md", Title: "new", RenamedFrom: "docs/old.md"}
+	content, err := f.findUploadPage(&m, []string{"version"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if content == nil || content.ID != "42" {
+		t.Errorf("page = %v, want page 42 of the previous path", content)
+	}
+}
+
+func TestFindUploadPageCollision(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/rest/api/content", titleSearch(map[string]confluence.Content{
+		"guide": testPage("42", "guide", "1", "7"),
+	}))
+	mux.HandleFunc("/rest/api/content/search", func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, map[string]interface{}{"results": []confluence.Content{}})
+	})
+	client, server := newTestClient(mux)
+	defer server.Close()
+
+	m := Markdown2Confluence{Space: "DOCS", client: client, manifest: emptyManifest()}
+	f := MarkdownFile{Path: "docs/guide.md", Title: "guide", Ancestor: "1"}
+	if _, err := f.findUploadPage(&m, []string{"version"}); err == nil {
+		t.Errorf("a page of the same title below another parent was taken over")
+	}
+}
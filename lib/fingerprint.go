@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// pageFingerprint hashes the rendered storage XHTML of a page together with
+// the contents of its attachments and its metadata, so that a change to any
+// of them is detected
+func pageFingerprint(content string, attachments []string, metadata interface{}) (string, error) {
+	h := sha256.New()
+	io.WriteString(h, content)
+
+	if metadata != nil {
+		b, err := json.Marshal(metadata)
+		if err != nil {
+			return "", err
+		}
+		h.Write(b)
+	}
+
+	for _, a := range attachments {
+		file, err := os.Open(a)
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, "\x00"+path.Base(a)+"\x00")
+		_, err = io.Copy(h, file)
+		file.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var (
+	storageMacroID    = regexp.MustCompile(`\s+ac:macro-id="[^"]*"`)
+	storageSelfClose  = regexp.MustCompile(`\s*/>`)
+	storageTagSpacing = regexp.MustCompile(`>\s+<`)
+	storageSpacing    = regexp.MustCompile(`\s+`)
+)
+
+// normalizeStorage removes the differences Confluence introduces when it
+// stores a page body, so that a remote body can be compared with a freshly
+// rendered one
+func normalizeStorage(s string) string {
+	s = storageMacroID.ReplaceAllString(s, "")
+	s = storageSelfClose.ReplaceAllString(s, "/>")
+	s = storageTagSpacing.ReplaceAllString(s, "><")
+	s = storageSpacing.ReplaceAllString(s, " ")
+	s = strings.Replace(s, "&nbsp;", " ", -1)
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,247 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeStorage(t *testing.T) {
+	tests := []struct {
+		name   string
+		local  string
+		remote string
+		equal  bool
+	}{
+		{
+			name:   "macro IDs added by Confluence",
+			local:  `<ac:structured-macro ac:name="info" ac:schema-version="1"><ac:rich-text-body><p>x</p></ac:rich-text-body></ac:structured-macro>`,
+			remote: `<ac:structured-macro ac:name="info" ac:schema-version="1" ac:macro-id="3f2a-11"><ac:rich-text-body><p>x</p></ac:rich-text-body></ac:structured-macro>`,
+			equal:  true,
+		},
+		{
+			name:   "self-closing tags",
+			local:  `<p>a<br/>b</p><ri:attachment ri:filename="a.png"/>`,
+			remote: `<p>a<br />b</p><ri:attachment ri:filename="a.png" />`,
+			equal:  true,
+		},
+		{
+			name:   "whitespace between tags",
+			local:  "<h1>Title</h1>\n<p>text</p>\n",
+			remote: "<h1>Title</h1><p>text</p>",
+			equal:  true,
+		},
+		{
+			name:   "runs of whitespace and non-breaking spaces",
+			local:  "<p>a  b\tc\u00a0d</p>",
+			remote: "<p>a b c&nbsp;d</p>",
+			equal:  true,
+		},
+		{
+			name:   "changed text",
+			local:  "<p>before</p>",
+			remote: "<p>after</p>",
+		},
+		{
+			name:   "whitespace within text matters",
+			local:  "<p>ab</p>",
+			remote: "<p>a b</p>",
+		},
+		{
+			name:   "changed attribute",
+			local:  `<ac:parameter ac:name="language">go</ac:parameter>`,
+			remote: `<ac:parameter ac:name="language">python</ac:parameter>`,
+		},
+		{
+			name:   "macro ID in text is kept",
+			local:  `<p>ac:macro-id</p>`,
+			remote: `<p>ac:macro-id="1"</p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, remote := normalizeStorage(tt.local), normalizeStorage(tt.remote)
+			if (local == remote) != tt.equal {
+				t.Errorf("normalized %q and %q, want equal: %v", local, remote, tt.equal)
+			}
+		})
+	}
+}
+
+func TestPageFingerprint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fingerprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	image := write("image.png", "png")
+	if err := os.Mkdir(filepath.Join(dir, "changed"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	changed := write("changed/image.png", "png, edited")
+	renamed := write("other.png", "png")
+
+	fingerprint := func(content string, attachments []string, metadata pageMetadata) string {
+		hash, err := pageFingerprint(content, attachments, metadata)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return hash
+	}
+	base := fingerprint("<p>x</p>", []string{image}, pageMetadata{Labels: []string{"a"}})
+
+	tests := []struct {
+		name        string
+		content     string
+		attachments []string
+		metadata    pageMetadata
+		same        bool
+	}{
+		{
+			name:        "identical",
+			content:     "<p>x</p>",
+			attachments: []string{image},
+			metadata:    pageMetadata{Labels: []string{"a"}},
+			same:        true,
+		},
+		{
+			name:        "changed content",
+			content:     "<p>y</p>",
+			attachments: []string{image},
+			metadata:    pageMetadata{Labels: []string{"a"}},
+		},
+		{
+			name:        "changed attachment contents",
+			content:     "<p>x</p>",
+			attachments: []string{changed},
+			metadata:    pageMetadata{Labels: []string{"a"}},
+		},
+		{
+			name:        "renamed attachment",
+			content:     "<p>x</p>",
+			attachments: []string{renamed},
+			metadata:    pageMetadata{Labels: []string{"a"}},
+		},
+		{
+			name:     "removed attachment",
+			content:  "<p>x</p>",
+			metadata: pageMetadata{Labels: []string{"a"}},
+		},
+		{
+			name:        "changed labels",
+			content:     "<p>x</p>",
+			attachments: []string{image},
+			metadata:    pageMetadata{Labels: []string{"b"}},
+		},
+		{
+			name:        "added property",
+			content:     "<p>x</p>",
+			attachments: []string{image},
+			metadata:    pageMetadata{Labels: []string{"a"}, Properties: map[string]interface{}{"owner": "docs"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if hash := fingerprint(tt.content, tt.attachments, tt.metadata); (hash == base) != tt.same {
+				t.Errorf("fingerprint %s, base %s, want the same: %v", hash, base, tt.same)
+			}
+		})
+	}
+
+	if _, err := pageFingerprint("<p>x</p>", []string{filepath.Join(dir, "missing.png")}, nil); err == nil {
+		t.Errorf("a missing attachment gave no error")
+	}
+}
+
+func TestUnchanged(t *testing.T) {
+	const body = "<p>text</p>"
+	existing := testPage("42", "Page", "7")
+	existing.Version.Number = 3
+	existing.Body.Storage.Value = "<p>text</p>\n"
+
+	tests := []struct {
+		name        string
+		title       string
+		ancestorID  string
+		entry       *ManifestEntry
+		content     string
+		fingerprint string
+		unchanged   bool
+	}{
+		{
+			name:      "same body",
+			title:     "Page",
+			content:   body,
+			unchanged: true,
+		},
+		{
+			name:       "same body and parent",
+			title:      "Page",
+			ancestorID: "7",
+			content:    body,
+			unchanged:  true,
+		},
+		{
+			name:    "changed body",
+			title:   "Page",
+			content: "<p>other</p>",
+		},
+		{
+			name:    "renamed",
+			title:   "Other",
+			content: body,
+		},
+		{
+			name:       "moved",
+			title:      "Page",
+			ancestorID: "8",
+			content:    body,
+		},
+		{
+			name:        "fingerprint of the published version",
+			title:       "Page",
+			entry:       &ManifestEntry{PageID: "42", Version: 3, Hash: "hash"},
+			content:     "<p>rendered differently</p>",
+			fingerprint: "hash",
+			unchanged:   true,
+		},
+		{
+			name:        "page edited since it was published",
+			title:       "Page",
+			entry:       &ManifestEntry{PageID: "42", Version: 2, Hash: "hash"},
+			content:     "<p>rendered differently</p>",
+			fingerprint: "hash",
+		},
+		{
+			name:        "changed fingerprint",
+			title:       "Page",
+			entry:       &ManifestEntry{PageID: "42", Version: 3, Hash: "old"},
+			content:     "<p>rendered differently</p>",
+			fingerprint: "hash",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Markdown2Confluence{manifest: emptyManifest()}
+			f := MarkdownFile{Path: "docs/page.md", Title: tt.title}
+			if tt.entry != nil {
+				m.manifest.Set(f.Path, *tt.entry)
+			}
+			if got := f.unchanged(&m, existing, tt.ancestorID, tt.content, tt.fingerprint); got != tt.unchanged {
+				t.Errorf("unchanged = %v, want %v", got, tt.unchanged)
+			}
+		})
+	}
+}
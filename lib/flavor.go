@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/justmiles/go-confluence"
+
+	r "markdownToConfluence/lib/renderer"
+)
+
+// flavor returns the --flavor of Confluence, Cloud unless set
+func (m *Markdown2Confluence) flavor() string {
+	if m.Flavor == "" {
+		return r.FlavorCloud
+	}
+	return m.Flavor
+}
+
+// mathMacro returns the --math-macro formulas are rendered with. The math
+// macros are an app of Confluence Cloud that Data Center does not have by
+// default, so there formulas are shown as code unless a macro is set.
+func (m *Markdown2Confluence) mathMacro() string {
+	if m.MathMacro != "" {
+		return m.MathMacro
+	}
+	if m.flavor() == r.FlavorDataCenter {
+		return r.CodeMacro
+	}
+	return r.MathMacro
+}
+
+// endpoint returns the base URL of the REST API. Confluence Cloud serves it
+// below /wiki, which is added when only the site is given; Data Center
+// serves it below the context path the endpoint is given with.
+func (m *Markdown2Confluence) endpoint() string {
+	endpoint := strings.TrimSuffix(m.Endpoint, "/")
+	if m.flavor() == r.FlavorCloud {
+		if u, err := url.Parse(endpoint); err == nil && strings.HasSuffix(u.Hostname(), ".atlassian.net") && u.Path == "" {
+			endpoint += "/wiki"
+		}
+	}
+	return endpoint
+}
+
+// pageURL returns the URL of a published page for the output of a sync.
+// Cloud pages get their short link, Data Center pages the link by ID,
+// which does not depend on the title and works without short links.
+func (m *Markdown2Confluence) pageURL(content confluence.Content) string {
+	if m.flavor() == r.FlavorCloud && content.Links.Tinyui != "" {
+		return m.client.Endpoint + content.Links.Tinyui
+	}
+	return m.client.Endpoint + "/pages/viewpage.action?pageId=" + url.QueryEscape(content.ID)
+}
@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// DefaultIndexFiles are the markdown files whose content becomes the page of
+// the folder they are in, unless --index-files says otherwise
+var DefaultIndexFiles = []string{"README.md"}
+
+// folderPageData is passed to the folder template
+type folderPageData struct {
+	// Title is the title of the folder page
+	Title string
+	// Path is the folder, empty for pages given by --parent or the front matter
+	Path string
+	// Children is the number of markdown files and folders in the folder
+	Children int
+}
+
+// indexFiles returns the configured index file names
+func (m *Markdown2Confluence) indexFiles() []string {
+	if len(m.IndexFiles) == 0 {
+		return DefaultIndexFiles
+	}
+	return m.IndexFiles
+}
+
+// isIndexFile reports whether p is an index file that stands for its folder
+func (m *Markdown2Confluence) isIndexFile(p string) bool {
+	for _, name := range m.indexFiles() {
+		if filepath.Base(p) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// folderIndexFile returns the first index file found in dir, or an empty
+// string if there is none that is uploaded
+func (m *Markdown2Confluence) folderIndexFile(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	for _, name := range m.indexFiles() {
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() && !m.IsExcluded(p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// folderPageBody renders the folder template for the folder page title
+func (m *Markdown2Confluence) folderPageBody(title, dir string) (string, error) {
+	if m.FolderTemplate == "" {
+		return defaultAncestorPage, nil
+	}
+
+	src, err := ioutil.ReadFile(m.FolderTemplate)
+	if err != nil {
+		return "", fmt.Errorf("Error reading folder template %s: %s", m.FolderTemplate, err)
+	}
+	tmpl, err := template.New(filepath.Base(m.FolderTemplate)).Parse(string(src))
+	if err != nil {
+		return "", fmt.Errorf("Error parsing folder template %s: %s", m.FolderTemplate, err)
+	}
+
+	data := folderPageData{Title: title, Path: filepath.ToSlash(dir)}
+	if dir != "" {
+		entries, _ := ioutil.ReadDir(dir)
+		for _, entry := range entries {
+			name := entry.Name()
+			if strings.HasPrefix(name, ".") || m.isIndexFile(name) {
+				continue
+			}
+			if entry.IsDir() || strings.HasSuffix(name, ".md") {
+				data.Children++
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("Error executing folder template %s: %s", m.FolderTemplate, err)
+	}
+	return buf.String(), nil
+}
+
+// createFolderFromIndex publishes the index file of a folder that has no
+// page yet, so that the folder page gets its content even when the index
+// file is not part of this upload, and returns the ID of the page
+func (f *MarkdownFile) createFolderFromIndex(m *Markdown2Confluence, index, parent string) (string, error) {
+	md, err := m.newMarkdownFile(index, f.root)
+	if err != nil {
+		return "", err
+	}
+	if md.Meta.Skip {
+		return "", fmt.Errorf("index file %s of folder %s sets skip", index, parent)
+	}
+	m.applyTitles(&md)
+
+	if _, err := md.Upload(m); err != nil && err != errUnchanged {
+		return "", fmt.Errorf("Error creating folder page %s from %s: %s", parent, index, err)
+	}
+	if m.DryRun {
+		return dryRunID(parent), nil
+	}
+	e, ok := m.manifest.Get(index)
+	if !ok {
+		return "", fmt.Errorf("Error creating folder page %s from %s", parent, index)
+	}
+	fmt.Printf("上传成功：%s --> %s\n", index, md.FormattedPath())
+	return e.PageID, nil
+}
+
+// resetFolderPage replaces the content of the page of a deleted index file
+// with the folder template, as the page still holds the pages of the folder
+func (f *MarkdownFile) resetFolderPage(m *Markdown2Confluence) error {
+	existing, err := f.findPage(m, []string{"version", "body.storage"})
+	if err != nil {
+		return fmt.Errorf("Error checking for existing page: %s", err)
+	}
+	if existing == nil {
+		m.manifest.Delete(f.Path)
+		return nil
+	}
+
+	body, err := m.folderPageBody(existing.Title, filepath.Dir(f.Path))
+	if err != nil {
+		return err
+	}
+	if m.DryRun {
+		m.Plan.Add(PlanAction{Kind: PlanUpdate, Title: existing.Title, Path: f.Path, Detail: "page " + existing.ID + ", index file deleted, folder template"})
+		return nil
+	}
+
+	content := *existing
+	content.Version.Number++
+	content.Version.Message = m.Comment
+	content.Body.Storage.Representation = "storage"
+	content.Body.Storage.Value = body
+	content.Ancestors = nil
+	if _, err := m.client.UpdateContent(&content, nil); err != nil {
+		return fmt.Errorf("Error updating content: %s", err)
+	}
+	m.manifest.Delete(f.Path)
+	return nil
+}
+
+// dirExists reports whether the folder dir exists
+func dirExists(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FrontMatter holds the per-page settings given in the YAML front matter of
+// a markdown file. They override the command line and config file defaults
+// for that file.
+type FrontMatter struct {
+	Title     string     `yaml:"title"`
+	Labels    []string   `yaml:"labels"`
+	Parent    string     `yaml:"parent"`
+	Space     string     `yaml:"space"`
+	PageID    string     `yaml:"page_id"`
+	Skip      bool       `yaml:"skip"`
+	HardWraps *bool      `yaml:"hardwraps"`
+	Toc       *TocConfig `yaml:"toc"`
+	Weight    *int       `yaml:"weight"`
+	Order     *int       `yaml:"order"`
+
+	// Properties collects all other keys, which are stored as content properties of the page
+	Properties map[string]interface{} `yaml:",inline"`
+}
+
+// splitFrontMatter separates the YAML front matter from the markdown body.
+// Files without front matter are returned unchanged.
+func splitFrontMatter(src []byte) (fm FrontMatter, body []byte, err error) {
+	src = bytes.TrimPrefix(src, []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(src, []byte("---\n")) && !bytes.HasPrefix(src, []byte("---\r\n")) {
+		return fm, src, nil
+	}
+
+	rest := src[bytes.IndexByte(src, '\n')+1:]
+	offset := 0
+	for offset < len(rest) {
+		end := bytes.IndexByte(rest[offset:], '\n')
+		var line []byte
+		if end < 0 {
+			line = rest[offset:]
+			end = len(rest)
+		} else {
+			line = rest[offset : offset+end]
+			end = offset + end + 1
+		}
+
+		trimmed := bytes.TrimRight(line, " \t\r")
+		if bytes.Equal(trimmed, []byte("---")) || bytes.Equal(trimmed, []byte("...")) {
+			if err = yaml.Unmarshal(rest[:offset], &fm); err != nil {
+				return fm, src, fmt.Errorf("invalid front matter: %s", err)
+			}
+			fm.Properties = jsonCompatible(fm.Properties).(map[string]interface{})
+			return fm, rest[end:], nil
+		}
+		offset = end
+	}
+
+	// No closing delimiter, so this is just a thematic break
+	return FrontMatter{}, src, nil
+}
+
+// jsonCompatible converts the map[interface{}]interface{} values produced by
+// the YAML decoder into values encoding/json can marshal
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonCompatible(value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = jsonCompatible(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonCompatible(value)
+		}
+		return v
+	}
+	return v
+}
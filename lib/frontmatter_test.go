@@ -0,0 +1,105 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		title  string
+		labels []string
+		props  map[string]interface{}
+		body   string
+		err    bool
+	}{
+		{
+			name: "no front matter",
+			src:  "# Title\n\ntext\n",
+			body: "# Title\n\ntext\n",
+		},
+		{
+			name:   "front matter",
+			src:    "---\ntitle: Page\nlabels: [a, b]\n---\n# Body\n",
+			title:  "Page",
+			labels: []string{"a", "b"},
+			body:   "# Body\n",
+		},
+		{
+			name:  "CRLF line endings",
+			src:   "---\r\ntitle: Page\r\n---\r\nbody\r\n",
+			title: "Page",
+			body:  "body\r\n",
+		},
+		{
+			name:  "byte order mark",
+			src:   "\xef\xbb\xbf---\ntitle: Page\n---\nbody\n",
+			title: "Page",
+			body:  "body\n",
+		},
+		{
+			name:  "dots close the front matter",
+			src:   "---\ntitle: Page\n...\nbody\n",
+			title: "Page",
+			body:  "body\n",
+		},
+		{
+			name:  "closing delimiter with trailing spaces",
+			src:   "---\ntitle: Page\n---  \nbody\n",
+			title: "Page",
+			body:  "body\n",
+		},
+		{
+			name:  "closing delimiter at end of file",
+			src:   "---\ntitle: Page\n---",
+			title: "Page",
+			body:  "",
+		},
+		{
+			name: "unclosed thematic break",
+			src:  "---\ntext\n",
+			body: "---\ntext\n",
+		},
+		{
+			name:  "other keys become properties",
+			src:   "---\ntitle: Page\nowner: team\nreview:\n  every: 90\n---\nbody\n",
+			title: "Page",
+			props: map[string]interface{}{"owner": "team", "review": map[string]interface{}{"every": 90}},
+			body:  "body\n",
+		},
+		{
+			name: "invalid YAML",
+			src:  "---\ntitle: [\n---\nbody\n",
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fm, body, err := splitFrontMatter([]byte(tt.src))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if fm.Title != tt.title {
+				t.Errorf("title = %q, want %q", fm.Title, tt.title)
+			}
+			if !reflect.DeepEqual(fm.Labels, tt.labels) {
+				t.Errorf("labels = %v, want %v", fm.Labels, tt.labels)
+			}
+			if len(tt.props) > 0 && !reflect.DeepEqual(fm.Properties, tt.props) {
+				t.Errorf("properties = %v, want %v", fm.Properties, tt.props)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
@@ -1,16 +1,44 @@
 package lib
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
+// Change statuses of a MarkdownFileFromGit
+const (
+	gitAdded    = "A"
+	gitModified = "M"
+	gitDeleted  = "D"
+	gitRenamed  = "R"
+)
+
 type MarkdownFileFromGit struct {
 	status string
 	path   string
+	// oldPath is the previous path of a renamed file
+	oldPath string
+}
+
+// gitChange is a single entry reported by git, with paths relative to the repository root
+type gitChange struct {
+	status  string
+	path    string
+	oldPath string
 }
 
+// GetMarkdownFile 获取 --from 与 --to 之间发生变化的markdown文件
+//
+// --from defaults to the commit recorded by the last successful sync and
+// --to to HEAD. Without --from, every markdown file of --to is synced. The
+// files are read from --to rather than the working tree, and the index is
+// never touched. With --worktree, uncommitted changes are synced as well,
+// read from the working tree.
 func GetMarkdownFile(m *Markdown2Confluence) []MarkdownFileFromGit {
 	// 获取当前工作目录
 	workspaceDir, err := os.Getwd()
@@ -24,119 +52,310 @@ func GetMarkdownFile(m *Markdown2Confluence) []MarkdownFileFromGit {
 	fmt.Printf("当前工作目录路径：%s\n", workspaceDir)
 	fmt.Println()
 
-	// 这里必须使文件先被跟踪
-	RunGitCommand("git", "add", ".")
-
-	// 检查返回值 workspace 是否为空 为空则表明工作区没有未提交的变更
-	workspaceFiles := RunGitCommand("git", "status", "--short")
-
-	if workspaceFiles == "" {
-		return nil
+	if err := m.loadManifest(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
-	statusFileList := strings.Split(workspaceFiles, "\n")
-
-	var uploadFileList []MarkdownFileFromGit
-
-	for _, value := range statusFileList {
-		if value != "" {
-			uploadFileList = append(uploadFileList, ProcessGitFilePath(value, m)...)
+	from := m.From
+	if from == "" {
+		from = m.manifest.LastCommit()
+	}
+	to := m.To
+	if to == "" {
+		to = "HEAD"
+	}
+	m.syncCommit = strings.TrimSpace(RunGitCommand("git", "rev-parse", "--verify", to+"^{commit}"))
+	topLevel := strings.TrimSpace(RunGitCommand("git", "rev-parse", "--show-toplevel"))
+
+	var changes []gitChange
+	if from == "" {
+		fmt.Printf("同步全部文件：%s\n", m.syncCommit)
+		changes = parseGitFileList(RunGitCommand("git", "-C", topLevel, "ls-tree", "-r", "-z", "--name-only", m.syncCommit))
+	} else {
+		fmt.Printf("同步变更：%s..%s\n", from, m.syncCommit)
+		// Paths outside the sync directory are diffed too, so that files moved across its boundary are detected
+		changes, err = parseGitNameStatus(RunGitCommand("git", "-c", "diff.relative=false", "-C", topLevel, "diff", "--name-status", "-z", "-M", "-l0", from, m.syncCommit))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
 	}
 
-	for i, uploadFile := range uploadFileList {
-		if !strings.HasSuffix(uploadFile.path, ".md") {
-			uploadFileList = append(uploadFileList[:i], uploadFileList[i+1:]...)
+	if m.Worktree {
+		fmt.Println("同步工作区中未提交的变更")
+		worktreeChanges, err := parseGitStatusV2(RunGitCommand("git", "-C", topLevel, "status", "--porcelain=v2", "-z", "--untracked-files=all"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
+		changes = mergeGitChanges(changes, worktreeChanges)
+		// Uncommitted changes are not part of any commit, so the next run has to pick them up again
+		m.syncCommit = ""
+	} else {
+		m.readCommit = m.syncCommit
+		m.gitTopLevel = topLevel
 	}
 
-	if len(uploadFileList) == 0 {
+	markdownFiles := m.markdownChanges(topLevel, workspaceDir, changes)
+
+	if len(markdownFiles) == 0 {
 		fmt.Println("暂无同步的markdown文件")
 		return nil
 	}
 
 	fmt.Printf("---------------------------正在同步...--------------------------\n")
 
-	return uploadFileList
+	return markdownFiles
 }
 
-func ProcessGitFilePath(path string, m *Markdown2Confluence) []MarkdownFileFromGit {
-
-	path = strings.TrimSpace(path)
+// readSource returns the contents of the file p. In Git mode they are read
+// from the commit being synced, so that neither another checkout nor
+// uncommitted edits end up on the pages. Files that are not part of that
+// commit, such as untracked files links point to, are read from disk.
+func (m *Markdown2Confluence) readSource(p string) ([]byte, error) {
+	if m.readCommit == "" {
+		return ioutil.ReadFile(p)
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(m.gitTopLevel, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ioutil.ReadFile(p)
+	}
 
-	// M: 修改 R：重命名 D：删除 A: 新增 ?: 未跟踪的
-	var statusList = [5]string{"M", "R", "D", "A", "?"}
-	var markdownFiles []MarkdownFileFromGit
+	var stdout bytes.Buffer
+	cmd := exec.Command("git", "-C", m.gitTopLevel, "show", m.readCommit+":"+filepath.ToSlash(rel))
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return ioutil.ReadFile(p)
+	}
+	return stdout.Bytes(), nil
+}
 
-	for _, code := range statusList {
-		if !strings.HasPrefix(path, code) {
-			continue
+// markdownChanges converts the changes reported by git into changes of the
+// markdown files in the sync directory, with paths relative to the working
+// directory. A file renamed into the sync set is added, one renamed out of
+// it is deleted.
+func (m *Markdown2Confluence) markdownChanges(topLevel, workspaceDir string, changes []gitChange) []MarkdownFileFromGit {
+	inSyncSet := func(p string) (string, bool) {
+		if p == "" || !strings.HasSuffix(p, ".md") {
+			return "", false
 		}
-		if strings.Contains(path, "->") {
-
-			var list = strings.Split(path, "->")
-
-			var st = MarkdownFileFromGit{
-				status: code,
-				path:   path,
-			}
+		rel, err := filepath.Rel(workspaceDir, filepath.Join(topLevel, filepath.FromSlash(p)))
+		if err != nil {
+			return "", false
+		}
+		dir := filepath.Clean(gitPathspec(m))
+		if dir == "." {
+			return rel, rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+		}
+		return rel, strings.HasPrefix(rel, dir+string(filepath.Separator))
+	}
 
-			for i, v := range list {
+	var markdownFiles []MarkdownFileFromGit
+	for _, change := range changes {
+		newPath, newOK := inSyncSet(change.path)
+		oldPath, oldOK := inSyncSet(change.oldPath)
+
+		switch {
+		case change.status == gitRenamed && newOK && oldOK:
+			markdownFiles = append(markdownFiles, MarkdownFileFromGit{status: gitRenamed, path: newPath, oldPath: oldPath})
+		case change.status == gitRenamed && newOK:
+			markdownFiles = append(markdownFiles, MarkdownFileFromGit{status: gitAdded, path: newPath})
+		case change.status == gitRenamed && oldOK:
+			markdownFiles = append(markdownFiles, MarkdownFileFromGit{status: gitDeleted, path: oldPath})
+		case change.status != gitRenamed && newOK:
+			markdownFiles = append(markdownFiles, MarkdownFileFromGit{status: change.status, path: newPath})
+		}
+	}
+	return markdownFiles
+}
 
-				var str = strings.TrimSpace(v)
+// gitPathspec returns the synchronization directory, relative to the working directory
+func gitPathspec(m *Markdown2Confluence) string {
+	if m.GitSyncDir == "" {
+		return "."
+	}
+	return m.GitSyncDir
+}
 
-				st.path = str
+// parseGitFileList parses the output of `git ls-files -z`. Every file is
+// reported as modified, so that its page is created or updated.
+func parseGitFileList(out string) []gitChange {
+	var changes []gitChange
+	for _, p := range strings.Split(out, "\x00") {
+		if p != "" {
+			changes = append(changes, gitChange{status: gitModified, path: p})
+		}
+	}
+	return changes
+}
 
-				if i == 0 {
-					st.status = "D"
-				} else {
-					st.status = "A"
-				}
+// parseGitNameStatus parses the output of `git diff --name-status -z`
+func parseGitNameStatus(out string) ([]gitChange, error) {
+	var changes []gitChange
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
+		if status == "" {
+			continue
+		}
 
-				if strings.HasSuffix(str, "\"") {
+		paths := 1
+		if status[0] == 'R' || status[0] == 'C' {
+			paths = 2
+		}
+		if i+paths >= len(fields) {
+			return nil, fmt.Errorf("unexpected git diff output: missing path after %q", status)
+		}
 
-					firstIndex := strings.Index(str, "\"")
-					lastIndex := strings.LastIndex(str, "\"")
+		switch status[0] {
+		case 'A':
+			changes = append(changes, gitChange{status: gitAdded, path: fields[i+1]})
+		case 'M', 'T':
+			// A type change, e.g. from a regular file to a symlink, is synced as a modification
+			changes = append(changes, gitChange{status: gitModified, path: fields[i+1]})
+		case 'D':
+			changes = append(changes, gitChange{status: gitDeleted, path: fields[i+1]})
+		case 'R':
+			changes = append(changes, gitChange{status: gitRenamed, path: fields[i+2], oldPath: fields[i+1]})
+		case 'C':
+			// The source of a copy is left untouched
+			changes = append(changes, gitChange{status: gitAdded, path: fields[i+2]})
+		case 'U':
+			return nil, fmt.Errorf("%s has unresolved merge conflicts", fields[i+1])
+		default:
+			return nil, fmt.Errorf("unknown git status %q for %s", status, fields[i+1])
+		}
+		i += paths
+	}
+	return changes, nil
+}
 
-					str = str[firstIndex+1 : lastIndex]
+// parseGitStatusV2 parses the output of `git status --porcelain=v2 -z` into
+// the changes between HEAD and the working tree, staged or not
+func parseGitStatusV2(out string) ([]gitChange, error) {
+	// A mode of 000000 means the file does not exist in HEAD or the working tree
+	const missing = "000000"
+
+	var changes []gitChange
+	entries := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if entry == "" {
+			continue
+		}
 
-					st.path = ConvertOctonaryUtf8(str)
-				} else if i == 0 {
-					st.path = strings.TrimSpace(str[strings.LastIndex(str, " "):])
-				}
-				if m.GitSyncDir != "" {
-					if strings.HasPrefix(st.path, m.GitSyncDir) {
-						markdownFiles = append(markdownFiles, st)
-					}
-				} else {
-					markdownFiles = append(markdownFiles, st)
-				}
+		switch entry[0] {
+		case '1':
+			// 1 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <path>
+			fields := strings.SplitN(entry, " ", 9)
+			if len(fields) < 9 {
+				return nil, fmt.Errorf("unexpected git status entry %q", entry)
+			}
+			inHead, inWorktree := fields[3] != missing, fields[5] != missing
+			switch {
+			case inHead && inWorktree:
+				changes = append(changes, gitChange{status: gitModified, path: fields[8]})
+			case inWorktree:
+				changes = append(changes, gitChange{status: gitAdded, path: fields[8]})
+			case inHead:
+				changes = append(changes, gitChange{status: gitDeleted, path: fields[8]})
+			}
+		case '2':
+			// 2 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <X><score> <path>, followed by <origPath>
+			fields := strings.SplitN(entry, " ", 10)
+			if len(fields) < 10 || i+1 >= len(entries) {
+				return nil, fmt.Errorf("unexpected git status entry %q", entry)
 			}
-			return markdownFiles
-		} else {
-			var st = MarkdownFileFromGit{
-				status: code,
-				path:   path,
+			origPath := entries[i+1]
+			i++
+			inWorktree := fields[5] != missing
+			switch {
+			case fields[8][0] == 'C' && inWorktree:
+				changes = append(changes, gitChange{status: gitAdded, path: fields[9]})
+			case fields[8][0] == 'R' && inWorktree:
+				changes = append(changes, gitChange{status: gitRenamed, path: fields[9], oldPath: origPath})
+			case fields[8][0] == 'R':
+				changes = append(changes, gitChange{status: gitDeleted, path: origPath})
 			}
-			if strings.HasSuffix(path, "\"") {
+		case 'u':
+			// u <XY> <sub> <m1> <m2> <m3> <mW> <h1> <h2> <h3> <path>
+			fields := strings.SplitN(entry, " ", 11)
+			return nil, fmt.Errorf("%s has unresolved merge conflicts", fields[len(fields)-1])
+		case '?':
+			changes = append(changes, gitChange{status: gitAdded, path: entry[2:]})
+		case '!', '#':
+			// Ignored files and headers
+		default:
+			return nil, fmt.Errorf("unexpected git status entry %q", entry)
+		}
+	}
+	return changes, nil
+}
 
-				firstIndex := strings.Index(path, "\"")
-				lastIndex := strings.LastIndex(path, "\"")
+// mergeGitChanges applies the changes in next on top of the changes in base,
+// so that e.g. a file added in base and modified in next is still added
+func mergeGitChanges(base, next []gitChange) []gitChange {
+	var order []string
+	seen := make(map[string]bool)
+	merged := make(map[string]gitChange)
+	set := func(c gitChange) {
+		if !seen[c.path] {
+			seen[c.path] = true
+			order = append(order, c.path)
+		}
+		merged[c.path] = c
+	}
 
-				st.path = ConvertOctonaryUtf8(path[firstIndex+1 : lastIndex])
-			} else {
-				st.path = strings.TrimSpace(path[strings.LastIndex(path, " "):])
+	for _, c := range base {
+		set(c)
+	}
+	for _, c := range next {
+		prev, ok := merged[c.path]
+		switch c.status {
+		case gitAdded:
+			if ok && prev.status == gitDeleted {
+				c.status = gitModified
+			}
+			set(c)
+		case gitModified:
+			if ok && prev.status != gitDeleted {
+				c = prev
 			}
-			if m.GitSyncDir != "" {
-				if strings.HasPrefix(st.path, m.GitSyncDir) {
-					markdownFiles = append(markdownFiles, st)
-				}
-			} else {
-				markdownFiles = append(markdownFiles, st)
+			set(c)
+		case gitDeleted:
+			switch {
+			case ok && prev.status == gitAdded:
+				delete(merged, c.path)
+			case ok && prev.status == gitRenamed:
+				delete(merged, c.path)
+				set(gitChange{status: gitDeleted, path: prev.oldPath})
+			default:
+				set(c)
 			}
+		case gitRenamed:
+			old, ok := merged[c.oldPath]
+			delete(merged, c.oldPath)
+			switch {
+			case ok && old.status == gitAdded:
+				set(gitChange{status: gitAdded, path: c.path})
+			case ok && old.status == gitRenamed:
+				set(gitChange{status: gitRenamed, path: c.path, oldPath: old.oldPath})
+			default:
+				set(c)
+			}
+		}
+	}
 
-			return markdownFiles
+	var changes []gitChange
+	for _, p := range order {
+		if c, ok := merged[p]; ok {
+			changes = append(changes, c)
 		}
 	}
-	return nil
+	return changes
 }
@@ -0,0 +1,379 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/justmiles/go-confluence"
+)
+
+func TestParseGitNameStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		changes []gitChange
+		err     bool
+	}{
+		{
+			name: "empty",
+			out:  "",
+		},
+		{
+			name: "added, modified and deleted",
+			out:  "A\x00docs/new.md\x00M\x00docs/old.md\x00D\x00docs/gone.md\x00",
+			changes: []gitChange{
+				{status: gitAdded, path: "docs/new.md"},
+				{status: gitModified, path: "docs/old.md"},
+				{status: gitDeleted, path: "docs/gone.md"},
+			},
+		},
+		{
+			name:    "type change is a modification",
+			out:     "T\x00docs/link.md\x00",
+			changes: []gitChange{{status: gitModified, path: "docs/link.md"}},
+		},
+		{
+			name: "rename with score",
+			out:  "R097\x00docs/a.md\x00docs/b.md\x00M\x00docs/c.md\x00",
+			changes: []gitChange{
+				{status: gitRenamed, path: "docs/b.md", oldPath: "docs/a.md"},
+				{status: gitModified, path: "docs/c.md"},
+			},
+		},
+		{
+			name:    "copy adds the destination only",
+			out:     "C100\x00docs/a.md\x00docs/copy.md\x00",
+			changes: []gitChange{{status: gitAdded, path: "docs/copy.md"}},
+		},
+		{
+			name:    "paths with spaces, tabs and newlines",
+			out:     "R100\x00docs/a b.md\x00docs/c\td\ne.md\x00",
+			changes: []gitChange{{status: gitRenamed, path: "docs/c\td\ne.md", oldPath: "docs/a b.md"}},
+		},
+		{
+			name: "unmerged",
+			out:  "U\x00docs/conflict.md\x00",
+			err:  true,
+		},
+		{
+			name: "unknown status",
+			out:  "X\x00docs/a.md\x00",
+			err:  true,
+		},
+		{
+			name: "rename missing its new path",
+			out:  "R100\x00docs/a.md\x00",
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := parseGitNameStatus(tt.out)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", changes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(changes, tt.changes) {
+				t.Errorf("changes = %v, want %v", changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestParseGitStatusV2(t *testing.T) {
+	const head = "1111111111111111111111111111111111111111"
+	const index = "2222222222222222222222222222222222222222"
+	const none = "0000000000000000000000000000000000000000"
+
+	tests := []struct {
+		name    string
+		out     string
+		changes []gitChange
+		err     bool
+	}{
+		{
+			name: "headers and ignored files",
+			out:  "# branch.oid " + head + "\x00# branch.head main\x00! build/out.md\x00",
+		},
+		{
+			name:    "modified in the working tree",
+			out:     "1 .M N... 100644 100644 100644 " + head + " " + head + " docs/a.md\x00",
+			changes: []gitChange{{status: gitModified, path: "docs/a.md"}},
+		},
+		{
+			name:    "staged new file",
+			out:     "1 A. N... 000000 100644 100644 " + none + " " + index + " docs/new.md\x00",
+			changes: []gitChange{{status: gitAdded, path: "docs/new.md"}},
+		},
+		{
+			name:    "deleted in the working tree",
+			out:     "1 .D N... 100644 100644 000000 " + head + " " + head + " docs/gone.md\x00",
+			changes: []gitChange{{status: gitDeleted, path: "docs/gone.md"}},
+		},
+		{
+			name: "added then deleted again",
+			out:  "1 AD N... 000000 100644 000000 " + none + " " + index + " docs/tmp.md\x00",
+		},
+		{
+			name:    "path with spaces",
+			out:     "1 .M N... 100644 100644 100644 " + head + " " + head + " docs/a b.md\x00",
+			changes: []gitChange{{status: gitModified, path: "docs/a b.md"}},
+		},
+		{
+			name:    "staged rename",
+			out:     "2 R. N... 100644 100644 100644 " + head + " " + head + " R100 docs/b.md\x00docs/a.md\x00",
+			changes: []gitChange{{status: gitRenamed, path: "docs/b.md", oldPath: "docs/a.md"}},
+		},
+		{
+			name:    "renamed then deleted",
+			out:     "2 RD N... 100644 100644 000000 " + head + " " + head + " R100 docs/b.md\x00docs/a.md\x00",
+			changes: []gitChange{{status: gitDeleted, path: "docs/a.md"}},
+		},
+		{
+			name:    "staged copy",
+			out:     "2 C. N... 100644 100644 100644 " + head + " " + head + " C100 docs/copy.md\x00docs/a.md\x00",
+			changes: []gitChange{{status: gitAdded, path: "docs/copy.md"}},
+		},
+		{
+			name:    "untracked",
+			out:     "? docs/draft.md\x00",
+			changes: []gitChange{{status: gitAdded, path: "docs/draft.md"}},
+		},
+		{
+			name: "unmerged",
+			out:  "u UU N... 100644 100644 100644 100644 " + head + " " + head + " " + head + " docs/conflict.md\x00",
+			err:  true,
+		},
+		{
+			name: "rename missing its original path",
+			out:  "2 R. N... 100644 100644 100644 " + head + " " + head + " R100 docs/b.md\x00",
+			err:  true,
+		},
+		{
+			name: "truncated entry",
+			out:  "1 .M N... 100644\x00",
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := parseGitStatusV2(tt.out)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", changes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(changes, tt.changes) {
+				t.Errorf("changes = %v, want %v", changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestMergeGitChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		base []gitChange
+		next []gitChange
+		want []gitChange
+	}{
+		{
+			name: "committed and uncommitted modification",
+			base: []gitChange{{status: gitModified, path: "a.md"}},
+			next: []gitChange{{status: gitModified, path: "a.md"}},
+			want: []gitChange{{status: gitModified, path: "a.md"}},
+		},
+		{
+			name: "added then modified stays added",
+			base: []gitChange{{status: gitAdded, path: "a.md"}},
+			next: []gitChange{{status: gitModified, path: "a.md"}},
+			want: []gitChange{{status: gitAdded, path: "a.md"}},
+		},
+		{
+			name: "deleted then added again",
+			base: []gitChange{{status: gitDeleted, path: "a.md"}},
+			next: []gitChange{{status: gitAdded, path: "a.md"}},
+			want: []gitChange{{status: gitModified, path: "a.md"}},
+		},
+		{
+			name: "added then deleted",
+			base: []gitChange{{status: gitAdded, path: "a.md"}},
+			next: []gitChange{{status: gitDeleted, path: "a.md"}},
+		},
+		{
+			name: "renamed then deleted deletes the original",
+			base: []gitChange{{status: gitRenamed, path: "b.md", oldPath: "a.md"}},
+			next: []gitChange{{status: gitDeleted, path: "b.md"}},
+			want: []gitChange{{status: gitDeleted, path: "a.md"}},
+		},
+		{
+			name: "renamed twice",
+			base: []gitChange{{status: gitRenamed, path: "b.md", oldPath: "a.md"}},
+			next: []gitChange{{status: gitRenamed, path: "c.md", oldPath: "b.md"}},
+			want: []gitChange{{status: gitRenamed, path: "c.md", oldPath: "a.md"}},
+		},
+		{
+			name: "added then renamed",
+			base: []gitChange{{status: gitAdded, path: "a.md"}},
+			next: []gitChange{{status: gitRenamed, path: "b.md", oldPath: "a.md"}},
+			want: []gitChange{{status: gitAdded, path: "b.md"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeGitChanges(tt.base, tt.next)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-read-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %s %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+	write("page.md", "committed\n")
+	git("add", "page.md")
+	git("commit", "-q", "-m", "first")
+	commit := git("rev-parse", "HEAD")
+	write("page.md", "uncommitted\n")
+	write("untracked.md", "untracked\n")
+
+	m := Markdown2Confluence{readCommit: commit, gitTopLevel: dir}
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "page.md", content: "committed\n"},
+		{name: "untracked.md", content: "untracked\n"},
+	}
+	for _, tt := range tests {
+		content, err := m.readSource(filepath.Join(dir, tt.name))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(content) != tt.content {
+			t.Errorf("%s = %q, want %q", tt.name, content, tt.content)
+		}
+	}
+
+	m = Markdown2Confluence{}
+	if content, _ := m.readSource(filepath.Join(dir, "page.md")); string(content) != "uncommitted\n" {
+		t.Errorf("without a commit page.md = %q, want the working tree", content)
+	}
+}
+
+func TestUploadRenamed(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry bool
+		fail  bool
+	}{
+		{name: "with a manifest entry", entry: true},
+		{name: "without a manifest entry"},
+		{name: "failed upload keeps the manifest entry", entry: true, fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "upload-renamed")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			oldPath, newPath := filepath.Join(dir, "old.md"), filepath.Join(dir, "new.md")
+			if err := ioutil.WriteFile(newPath, []byte("# New\n\nmoved\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			page := testPage("42", "old", "1")
+			page.Version.Number = 3
+			var updated []string
+			mux := http.NewServeMux()
+			mux.Handle("/rest/api/content", titleSearch(map[string]confluence.Content{"old": page}))
+			mux.HandleFunc("/rest/api/content/", func(w http.ResponseWriter, req *http.Request) {
+				switch {
+				case req.URL.Path != "/rest/api/content/42":
+					http.NotFound(w, req)
+				case req.Method == http.MethodGet:
+					writeJSON(w, page)
+				case req.Method == http.MethodPut && tt.fail:
+					http.Error(w, "unavailable", http.StatusBadRequest)
+				case req.Method == http.MethodPut:
+					updated = append(updated, req.URL.Path)
+					var content confluence.Content
+					json.NewDecoder(req.Body).Decode(&content)
+					writeJSON(w, content)
+				default:
+					http.NotFound(w, req)
+				}
+			})
+			client, server := newTestClient(mux)
+			defer server.Close()
+
+			manifest := emptyManifest()
+			if tt.entry {
+				manifest.Set(oldPath, ManifestEntry{PageID: "42", Title: "old", ParentID: "1", Version: 3})
+			}
+			m := Markdown2Confluence{Space: "DOCS", client: client, manifest: manifest}
+			f := MarkdownFile{Path: newPath, Title: "new", Ancestor: "1", RenamedFrom: oldPath}
+			_, err = f.Upload(&m)
+			if tt.fail != (err != nil) {
+				t.Fatalf("err = %v, want an error: %v", err, tt.fail)
+			}
+
+			_, oldOK := manifest.Get(oldPath)
+			e, newOK := manifest.Get(newPath)
+			if tt.fail {
+				if !oldOK || newOK {
+					t.Errorf("after a failed upload the manifest has the old path: %v, the new path: %v, want only the old path", oldOK, newOK)
+				}
+				return
+			}
+			if len(updated) != 1 {
+				t.Errorf("updated %v, want page 42 updated once", updated)
+			}
+			if oldOK || !newOK || e.PageID != "42" || e.Title != "new" {
+				t.Errorf("manifest has the old path: %v, the new path: %v %+v, want page 42 under the new path only", oldOK, newOK, e)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultStateFile is where the sync manifest is kept unless --state-file says otherwise
+const DefaultStateFile = ".confluence-state.json"
+
+// ManifestEntry records the page a source file was last published to
+type ManifestEntry struct {
+	PageID   string `json:"pageId"`
+	Title    string `json:"title"`
+	ParentID string `json:"parentId,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+	Version  int    `json:"version"`
+}
+
+// Manifest maps source paths to Confluence pages so that later runs can
+// address pages by ID instead of searching by title
+type Manifest struct {
+	mu           sync.Mutex
+	path         string
+	SyncedCommit string                   `json:"lastCommit,omitempty"`
+	Pages        map[string]ManifestEntry `json:"pages"`
+}
+
+// LoadManifest reads the manifest at path. A missing file yields an empty manifest.
+func LoadManifest(path string) (*Manifest, error) {
+	s := &Manifest{
+		path:  path,
+		Pages: make(map[string]ManifestEntry),
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(buf, s); err != nil {
+		return nil, err
+	}
+	if s.Pages == nil {
+		s.Pages = make(map[string]ManifestEntry)
+	}
+	return s, nil
+}
+
+// Get returns the entry recorded for the source file p
+func (s *Manifest) Get(p string) (ManifestEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.Pages[manifestKey(p)]
+	return e, ok
+}
+
+// Set records the page the source file p was published to
+func (s *Manifest) Set(p string, e ManifestEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Pages[manifestKey(p)] = e
+}
+
+// Delete forgets the source file p
+func (s *Manifest) Delete(p string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Pages, manifestKey(p))
+}
+
+// Owner returns the source file the page id was published for, or an empty
+// string if it is not recorded
+func (s *Manifest) Owner(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p, e := range s.Pages {
+		if e.PageID == id {
+			return p
+		}
+	}
+	return ""
+}
+
+// LastCommit returns the commit the last successful Git mode sync ran up to
+func (s *Manifest) LastCommit() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.SyncedCommit
+}
+
+// SetLastCommit records the commit a Git mode sync ran up to
+func (s *Manifest) SetLastCommit(commit string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.SyncedCommit = commit
+}
+
+// Entries returns a copy of all recorded entries keyed by source path
+func (s *Manifest) Entries() map[string]ManifestEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make(map[string]ManifestEntry, len(s.Pages))
+	for k, v := range s.Pages {
+		entries[k] = v
+	}
+	return entries
+}
+
+// Save writes the manifest back to the file it was loaded from
+func (s *Manifest) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, append(buf, '\n'), 0644)
+}
+
+// manifestKey normalizes a source path so that the same file is found
+// whether it was passed as a relative, absolute or Windows style path
+func manifestKey(p string) string {
+	if filepath.IsAbs(p) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, p); err == nil {
+				p = rel
+			}
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(p))
+}
@@ -3,8 +3,6 @@ package lib
 import (
 	"bytes"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -12,13 +10,13 @@ import (
 	"sync"
 	"time"
 
-	"github.com/justmiles/go-confluence"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer/html"
 
 	e "markdownToConfluence/lib/extension"
+	r "markdownToConfluence/lib/renderer"
 )
 
 const (
@@ -42,30 +40,110 @@ type Markdown2Confluence struct {
 	Since                 int
 	Username              string
 	Password              string
+	Token                 string
+	Auth                  string
+	Flavor                string
+	API                   string
 	Endpoint              string
 	Parent                string
 	SourceMarkdown        []string
 	SourceMarkdownFromGit []MarkdownFileFromGit
 	DeleteMarkdown        []string
 	ExcludeFilePatterns   []string
-	client                *confluence.Client
+	client                *Client
 	GitSyncDir            string
 	Model                 string
+	DryRun                bool
+	Plan                  *Plan
+	StateFile             string
+	manifest              *Manifest
+	pages                 map[string]r.PageLink
+	syncPaths             map[string]bool
+	Prune                 bool
+	PruneArchive          string
+	PruneKeep             []string
+	PruneLimit            int
+	From                  string
+	To                    string
+	Worktree              bool
+	syncCommit            string
+	readCommit            string
+	gitTopLevel           string
+	Force                 bool
+	OnConflict            string
+	MathMacro             string
+	Diagrams              map[string]r.Diagram
+	DiagramCache          string
+	Toc                   TocConfig
+	Header                string
+	Footer                string
+	IndexFiles            []string
+	FolderTemplate        string
+	OrderPages            bool
+	TitleCollision        string
+	MaxRetries            int
+	Timeout               time.Duration
+	Proxy                 string
+	CACerts               []string
+	ClientCert            string
+	ClientKey             string
+	InsecureSkipVerify    bool
+	siblings              map[string][]orderedPage
+	indexed               []MarkdownFile
+	titles                map[string]string
+	conflicts             int32
 }
 
 // CreateClient returns a new markdown clietn
-func (m *Markdown2Confluence) CreateClient() {
-	m.client = new(confluence.Client)
-	m.client.Username = m.Username
-	m.client.Password = m.Password
-	m.client.Endpoint = m.Endpoint
-	m.client.Debug = m.Debug
+func (m *Markdown2Confluence) CreateClient() error {
+	httpClient, err := m.newHTTPClient()
+	if err != nil {
+		return err
+	}
+	m.client = NewClient(m.endpoint(), m.authenticator(), m.Debug, httpClient)
+	m.client.Flavor = m.flavor()
+	m.client.API = m.api()
+
+	if m.DryRun && m.Plan == nil {
+		m.Plan = new(Plan)
+	}
+	return nil
+}
+
+// loadManifest reads the sync manifest from m.StateFile
+func (m *Markdown2Confluence) loadManifest() error {
+	if m.manifest != nil {
+		return nil
+	}
+	if m.StateFile == "" {
+		m.StateFile = DefaultStateFile
+	}
+	manifest, err := LoadManifest(m.StateFile)
+	if err != nil {
+		return fmt.Errorf("Error reading state file %s: %s", m.StateFile, err)
+	}
+	m.manifest = manifest
+	return nil
+}
+
+// saveManifest writes the sync manifest back, unless this is a dry run
+func (m *Markdown2Confluence) saveManifest() error {
+	if m.DryRun || m.manifest == nil {
+		return nil
+	}
+	if err := m.manifest.Save(); err != nil {
+		return fmt.Errorf("Error writing state file %s: %s", m.StateFile, err)
+	}
+	return nil
 }
 
 // SourceEnvironmentVariables overrides Markdown2Confluence with any environment variables that are set
 //  - CONFLUENCE_USERNAME
 //  - CONFLUENCE_PASSWORD
+//  - CONFLUENCE_TOKEN
+//  - CONFLUENCE_AUTH
 //  - CONFLUENCE_ENDPOINT
+//  - CONFLUENCE_FLAVOR
 func (m *Markdown2Confluence) SourceEnvironmentVariables(conf *ConfluenceConfig) {
 	var s string
 	s = os.Getenv("CONFLUENCE_USERNAME")
@@ -78,11 +156,26 @@ func (m *Markdown2Confluence) SourceEnvironmentVariables(conf *ConfluenceConfig)
 		m.Password = s
 	}
 
+	s = os.Getenv("CONFLUENCE_TOKEN")
+	if s != "" && conf.Token == "" {
+		m.Token = s
+	}
+
+	s = os.Getenv("CONFLUENCE_AUTH")
+	if s != "" && conf.Auth == "" {
+		m.Auth = s
+	}
+
 	s = os.Getenv("CONFLUENCE_ENDPOINT")
 	if s != "" && conf.Endpoint == "" {
 		m.Endpoint = s
 	}
 
+	s = os.Getenv("CONFLUENCE_FLAVOR")
+	if s != "" && conf.Flavor == "" {
+		m.Flavor = s
+	}
+
 	s = os.Getenv("CONFLUENCE_SPACE")
 	if s != "" && conf.Space == "" {
 		m.Space = s
@@ -114,11 +207,8 @@ func (m Markdown2Confluence) Validate() error {
 	if m.Space == "" {
 		return fmt.Errorf("--space is not defined")
 	}
-	if m.Username == "" {
-		return fmt.Errorf("--username is not defined")
-	}
-	if m.Password == "" {
-		return fmt.Errorf("--password is not defined")
+	if err := m.validateAuth(); err != nil {
+		return err
 	}
 	if m.Endpoint == "" {
 		return fmt.Errorf("--endpoint is not defined")
@@ -127,6 +217,56 @@ func (m Markdown2Confluence) Validate() error {
 		return fmt.Errorf("--endpoint is not defined")
 	}
 
+	switch m.Flavor {
+	case "", r.FlavorCloud, r.FlavorDataCenter:
+	default:
+		return fmt.Errorf("--flavor must be %s or %s", r.FlavorCloud, r.FlavorDataCenter)
+	}
+	if err := m.validateAPI(); err != nil {
+		return err
+	}
+
+	if m.Prune && m.Parent == "" {
+		return fmt.Errorf("--prune requires --parent")
+	}
+
+	switch m.OnConflict {
+	case "", ConflictFail, ConflictSkip, ConflictOverwrite:
+	default:
+		return fmt.Errorf("--on-conflict must be one of %s, %s or %s", ConflictFail, ConflictSkip, ConflictOverwrite)
+	}
+
+	switch m.MathMacro {
+	case "", r.MathMacro, r.LatexMacro, r.CodeMacro:
+	default:
+		return fmt.Errorf("--math-macro must be %s, %s or %s", r.MathMacro, r.LatexMacro, r.CodeMacro)
+	}
+
+	if m.MaxRetries < 0 {
+		return fmt.Errorf("--max-retries must not be negative")
+	}
+	if m.Timeout < 0 {
+		return fmt.Errorf("--timeout must not be negative")
+	}
+
+	switch m.TitleCollision {
+	case "", CollisionFail, CollisionPrefix, CollisionPath:
+	default:
+		return fmt.Errorf("--title-collision must be one of %s, %s or %s", CollisionFail, CollisionPrefix, CollisionPath)
+	}
+
+	if err := m.Toc.validate(); err != nil {
+		return err
+	}
+
+	if err := m.validateDiagrams(); err != nil {
+		return err
+	}
+
+	if m.Worktree && m.To != "" {
+		return fmt.Errorf("--worktree can not be combined with --to")
+	}
+
 	if m.Model == "Git" {
 		return nil
 	}
@@ -137,26 +277,165 @@ func (m Markdown2Confluence) Validate() error {
 	if len(m.SourceMarkdown) > 1 && m.Title != "" {
 		return fmt.Errorf("You can not set the title for multiple files")
 	}
+	// Pages of files that are not given would look stale
+	if m.Prune {
+		for _, source := range m.SourceMarkdown {
+			if info, err := os.Stat(source); err == nil && !info.IsDir() {
+				return fmt.Errorf("--prune requires directories, %s is a file", source)
+			}
+		}
+	}
 	return nil
 }
 
 func (m *Markdown2Confluence) IsExcluded(p string) bool {
+	if pattern := m.excludedBy(p); pattern != "" {
+		fmt.Printf("excluding markdown file '%s': exclude pattern '%s'\n", p, pattern)
+		return true
+	}
+
+	return false
+}
+
+// excludedBy returns the first exclude pattern matching p
+func (m *Markdown2Confluence) excludedBy(p string) string {
 	for _, pattern := range m.ExcludeFilePatterns {
-		r := regexp.MustCompile(pattern)
-		if r.MatchString(p) {
-			fmt.Printf("excluding markdown file '%s': exclude pattern '%s'\n", p, pattern)
-			return true
+		re := regexp.MustCompile(pattern)
+		if re.MatchString(p) {
+			return pattern
 		}
 	}
+	return ""
+}
 
-	return false
+// newMarkdownFile derives the page title and parent pages of the markdown
+// file p from its location below root. An index file such as README.md
+// becomes the page of the folder it is in.
+func (m *Markdown2Confluence) newMarkdownFile(p, root string) (MarkdownFile, error) {
+	var title string
+	var parents, parentDirs []string
+
+	fm, body, err := m.readMarkdownFile(p)
+	if err != nil {
+		return MarkdownFile{}, fmt.Errorf("Error reading file %s: %s", p, err)
+	}
+
+	folders := deleteFromSlice(strings.Split(filepath.ToSlash(filepath.Dir(strings.TrimPrefix(p, root))), "/"), ".")
+	for i, folder := range folders {
+		if folder != "" {
+			parents = append(parents, folder)
+			parentDirs = append(parentDirs, filepath.Join(root, filepath.FromSlash(strings.Join(folders[:i+1], "/"))))
+		}
+	}
+
+	// An index file at the top of a git repository has no folder to stand for
+	if m.isIndexFile(p) && strings.Contains(p, "/") {
+		title = strings.Split(p, "/")[len(strings.Split(p, "/"))-2]
+		if len(parents) > 0 && parents[len(parents)-1] == title {
+			parents = parents[:len(parents)-1]
+			parentDirs = parentDirs[:len(parentDirs)-1]
+		}
+	} else {
+		title = strings.TrimSuffix(filepath.Base(p), ".md")
+	}
+
+	if m.OrderPages {
+		title = stripOrderPrefix(title)
+		for i := range parents {
+			parents[i] = stripOrderPrefix(parents[i])
+		}
+	}
+
+	if m.UseDocumentTitle == true {
+		docTitle := getDocumentTitle(body)
+		if docTitle != "" {
+			title = docTitle
+		}
+	}
+
+	md := MarkdownFile{
+		Path:       p,
+		Parents:    parents,
+		Title:      title,
+		Space:      m.Space,
+		parentDirs: parentDirs,
+		root:       root,
+	}
+
+	if m.Parent != "" {
+		parents := strings.Split(m.Parent, "/")
+		md.Parents = append(parents, md.Parents...)
+		md.Parents = deleteEmpty(md.Parents)
+	}
+
+	m.applyFrontMatter(&md, fm)
+
+	return md, nil
+}
+
+// applyFrontMatter overrides the title, space and parent pages derived for
+// md with the ones given in its front matter
+func (m *Markdown2Confluence) applyFrontMatter(md *MarkdownFile, fm FrontMatter) {
+	md.Meta = fm
+	if fm.Title != "" {
+		md.Title = fm.Title
+	}
+	if fm.Space != "" {
+		md.Space = fm.Space
+	}
+	if fm.Parent != "" {
+		md.Parents = deleteEmpty(strings.Split(fm.Parent, "/"))
+		md.parentDirs = nil
+	}
+}
+
+// indexPage remembers the page md is published to, so that links from
+// other markdown files can be resolved to it once resolveTitles ran
+func (m *Markdown2Confluence) indexPage(md MarkdownFile) {
+	m.indexed = append(m.indexed, md)
+}
+
+// indexMarkdownFiles indexes every markdown file below root
+func (m *Markdown2Confluence) indexMarkdownFiles(root string) error {
+	if root == "" {
+		root = "."
+	}
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && strings.HasSuffix(p, ".md") && m.excludedBy(p) == "" {
+			md, err := m.newMarkdownFile(p, m.GitSyncDir)
+			if err != nil {
+				return err
+			}
+			if !md.Meta.Skip {
+				m.indexPage(md)
+			}
+		}
+		return nil
+	})
+}
+
+// resolvePage implements renderer.PageResolver on the indexed pages
+func (m *Markdown2Confluence) resolvePage(p string) (r.PageLink, bool) {
+	page, ok := m.pages[p]
+	return page, ok
 }
 
 // Run the sync
 func (m *Markdown2Confluence) Run() []error {
 	var markdownFiles []MarkdownFile
 	var now = time.Now()
-	m.CreateClient()
+	if err := m.CreateClient(); err != nil {
+		return []error{err}
+	}
+	if err := m.loadManifest(); err != nil {
+		return []error{err}
+	}
 
 	for _, f := range m.SourceMarkdown {
 		file, err := os.Open(f)
@@ -187,6 +466,20 @@ func (m *Markdown2Confluence) Run() []error {
 
 					if strings.HasSuffix(path, ".md") && !m.IsExcluded(path) {
 
+						md, err = m.newMarkdownFile(path, f)
+						if err != nil {
+							return err
+						}
+						if md.Meta.Skip {
+							if m.Debug {
+								fmt.Printf("skipping %s: skip is set in the front matter\n", path)
+							}
+							return nil
+						}
+
+						// Links to files that are not uploaded this time must still resolve
+						m.indexPage(md)
+
 						// Only include this file if it was modified m.Since minutes ago
 						if m.Since != 0 {
 							if info.ModTime().Unix() < now.Add(time.Duration(m.Since*-1)*time.Minute).Unix() {
@@ -197,56 +490,32 @@ func (m *Markdown2Confluence) Run() []error {
 							}
 						}
 
-						var tempTitle string
-						var tempParents []string
-
-						if strings.HasSuffix(path, "README.md") {
-							tempTitle = strings.Split(path, "/")[len(strings.Split(path, "/"))-2]
-							tempParents = deleteFromSlice(deleteFromSlice(strings.Split(filepath.ToSlash(filepath.Dir(strings.TrimPrefix(path, f))), "/"), "."), tempTitle)
-						} else {
-							tempTitle = strings.TrimSuffix(filepath.Base(path), ".md")
-							tempParents = deleteFromSlice(strings.Split(filepath.ToSlash(filepath.Dir(strings.TrimPrefix(path, f))), "/"), ".")
-						}
-
-						if m.UseDocumentTitle == true {
-							docTitle := getDocumentTitle(path)
-							if docTitle != "" {
-								tempTitle = docTitle
-							}
-						}
-
-						md = MarkdownFile{
-							Path:    path,
-							Parents: tempParents,
-							Title:   tempTitle,
-						}
-
-						if m.Parent != "" {
-							parents := strings.Split(m.Parent, "/")
-							md.Parents = append(parents, md.Parents...)
-							md.Parents = deleteEmpty(md.Parents)
-						}
-
 						markdownFiles = append(markdownFiles, md)
 
 					}
 					return nil
 				})
 			if err != nil {
-				return []error{fmt.Errorf("Unable to walk path: %s", f)}
+				return []error{fmt.Errorf("Unable to walk path %s: %s", f, err)}
 			}
 
 		} else {
 			if strings.HasSuffix(f, ".md") && !m.IsExcluded(f) {
 
+				fm, body, err := m.readMarkdownFile(f)
+				if err != nil {
+					return []error{fmt.Errorf("Error reading file %s: %s", f, err)}
+				}
+
 				md = MarkdownFile{
 					Path:  f,
 					Title: m.Title,
+					Space: m.Space,
 				}
 
 				if md.Title == "" {
 					if m.UseDocumentTitle == true {
-						md.Title = getDocumentTitle(f)
+						md.Title = getDocumentTitle(body)
 					}
 					if md.Title == "" {
 						md.Title = strings.TrimSuffix(filepath.Base(f), ".md")
@@ -259,23 +528,37 @@ func (m *Markdown2Confluence) Run() []error {
 					md.Parents = deleteEmpty(md.Parents)
 				}
 
+				m.applyFrontMatter(&md, fm)
+				if md.Meta.Skip {
+					continue
+				}
+
+				m.indexPage(md)
 				markdownFiles = append(markdownFiles, md)
 			}
 		}
 
 	}
 
+	if err := m.resolveTitles(); err != nil {
+		return []error{err}
+	}
+	for i := range markdownFiles {
+		m.applyTitles(&markdownFiles[i])
+	}
+
 	var errors []error
 
 	var (
-		wg    = sync.WaitGroup{}
-		queue = make(chan MarkdownFile)
+		wg       = sync.WaitGroup{}
+		errorsMu = sync.Mutex{}
+		queue    = make(chan MarkdownFile)
 	)
 
 	// Process the queue
 	for worker := 0; worker < Parallelism; worker++ {
 		wg.Add(1)
-		go m.queueProcessor(&wg, &queue, &errors)
+		go m.queueProcessor(&wg, &queue, &errors, &errorsMu)
 	}
 
 	for _, markdownFile := range markdownFiles {
@@ -285,7 +568,7 @@ func (m *Markdown2Confluence) Run() []error {
 			var err error
 			markdownFile.Ancestor, err = markdownFile.FindOrCreateAncestors(m)
 			if err != nil {
-				errors = append(errors, err)
+				appendError(&errors, &errorsMu, err)
 				continue
 			}
 		}
@@ -297,6 +580,16 @@ func (m *Markdown2Confluence) Run() []error {
 
 	wg.Wait()
 
+	errors = append(errors, m.orderPages()...)
+
+	if m.Prune {
+		errors = append(errors, m.prune()...)
+	}
+
+	if err := m.saveManifest(); err != nil {
+		errors = append(errors, err)
+	}
+
 	return errors
 }
 
@@ -304,94 +597,54 @@ func (m *Markdown2Confluence) GitRun() []error {
 	var markdownFiles []MarkdownFile
 	var deleteMarkdownFiles []MarkdownFile
 	var addMarkdownFiles []MarkdownFile
-	m.CreateClient()
+	if err := m.CreateClient(); err != nil {
+		return []error{err}
+	}
+	if err := m.loadManifest(); err != nil {
+		return []error{err}
+	}
+
+	// Only changed files are uploaded, but links may point to any file in the sync directory
+	if err := m.indexMarkdownFiles(m.GitSyncDir); err != nil {
+		return []error{err}
+	}
+	if err := m.resolveTitles(); err != nil {
+		return []error{err}
+	}
 
 	for _, value := range m.SourceMarkdownFromGit {
 		f := value.path
 		status := value.status
-		var md MarkdownFile
-		if status == "D" {
-			var tempParents []string
-			if m.GitSyncDir != "" {
-				tempParents = deleteFromSlice(strings.Split(filepath.ToSlash(filepath.Dir(strings.TrimPrefix(f, m.GitSyncDir))), "/"), ".")
-			} else {
-				tempParents = deleteFromSlice(strings.Split(filepath.ToSlash(filepath.Dir(f)), "/"), ".")
-			}
-			md = MarkdownFile{
-				Path:    f,
-				Parents: tempParents,
-				Title:   strings.TrimSuffix(filepath.Base(f), ".md"),
-			}
-
-			if m.Parent != "" {
-				parents := strings.Split(m.Parent, "/")
-				md.Parents = append(parents, md.Parents...)
-				md.Parents = deleteEmpty(md.Parents)
-			}
-
-			deleteMarkdownFiles = append(deleteMarkdownFiles, md)
+		if status == gitDeleted {
+			deleteMarkdownFiles = append(deleteMarkdownFiles, m.deletedMarkdownFile(f))
 			continue
 		}
 
-		file, err := os.Open(f)
-
-		defer file.Close()
-
-		if err != nil {
-			return []error{fmt.Errorf("Error opening file %s", err)}
-		}
-
-		_, err = file.Stat()
-		if err != nil {
-			return []error{fmt.Errorf("Error reading file meta %s", err)}
-		}
-
-		if strings.HasSuffix(f, ".md") && !m.IsExcluded(f) {
-
-			var tempTitle string
-			var tempParents []string
-
-			if strings.HasSuffix(f, "README.md") {
-				tempTitle = strings.Split(f, "/")[len(strings.Split(f, "/"))-2]
-				if m.GitSyncDir != "" {
-					tempParents = deleteFromSlice(deleteFromSlice(strings.Split(filepath.ToSlash(filepath.Dir(strings.TrimPrefix(f, m.GitSyncDir))), "/"), "."), tempTitle)
-				} else {
-					tempParents = deleteFromSlice(deleteFromSlice(strings.Split(filepath.ToSlash(filepath.Dir(f)), "/"), "."), tempTitle)
-				}
-			} else {
-				tempTitle = strings.TrimSuffix(filepath.Base(f), ".md")
-				if m.GitSyncDir != "" {
-					tempParents = deleteFromSlice(strings.Split(filepath.ToSlash(filepath.Dir(strings.TrimPrefix(f, m.GitSyncDir))), "/"), ".")
-				} else {
-					tempParents = deleteFromSlice(strings.Split(filepath.ToSlash(filepath.Dir(f)), "/"), ".")
-				}
-			}
-
-			if m.UseDocumentTitle == true {
-				docTitle := getDocumentTitle(f)
-				if docTitle != "" {
-					tempTitle = docTitle
-				}
-			}
-
-			md = MarkdownFile{
-				Path:    f,
-				Parents: tempParents,
-				Title:   tempTitle,
+		var md MarkdownFile
+		var err error
+		if !m.IsExcluded(f) {
+			md, err = m.newMarkdownFile(f, m.GitSyncDir)
+			if err != nil {
+				return []error{err}
 			}
-
-			if m.Parent != "" {
-				parents := strings.Split(m.Parent, "/")
-				md.Parents = append(parents, md.Parents...)
-				md.Parents = deleteEmpty(md.Parents)
+			m.applyTitles(&md)
+		}
+		if md.Path == "" || md.Meta.Skip {
+			// A file renamed out of the sync set takes its page along
+			if status == gitRenamed {
+				deleteMarkdownFiles = append(deleteMarkdownFiles, m.deletedMarkdownFile(value.oldPath))
 			}
+			continue
+		}
 
-			switch status {
-			case "M": // 修改
-				markdownFiles = append(markdownFiles, md)
-			case "A": // 新增
-				addMarkdownFiles = append(addMarkdownFiles, md)
-			}
+		switch status {
+		case gitModified: // 修改
+			markdownFiles = append(markdownFiles, md)
+		case gitRenamed: // 重命名，沿用原页面
+			md.RenamedFrom = value.oldPath
+			markdownFiles = append(markdownFiles, md)
+		case gitAdded: // 新增
+			addMarkdownFiles = append(addMarkdownFiles, md)
 		}
 	}
 
@@ -399,6 +652,7 @@ func (m *Markdown2Confluence) GitRun() []error {
 
 	var (
 		wg       = sync.WaitGroup{}
+		errorsMu = sync.Mutex{}
 		queue    = make(chan MarkdownFile)
 		addQueue = make(chan MarkdownFile)
 	)
@@ -406,20 +660,29 @@ func (m *Markdown2Confluence) GitRun() []error {
 	// Process the queue
 	for worker := 0; worker < Parallelism; worker++ {
 		wg.Add(2)
-		go m.queueProcessor(&wg, &queue, &errors)
-		go m.addQueueProcessor(&wg, &addQueue, &errors)
+		go m.queueProcessor(&wg, &queue, &errors, &errorsMu)
+		go m.addQueueProcessor(&wg, &addQueue, &errors, &errorsMu)
 	}
 
 	// 删除云端文件
 	for _, markdownFile := range deleteMarkdownFiles {
 		var err error
+		// The page of a folder that still exists keeps the pages in it
+		if m.isIndexFile(markdownFile.Path) && dirExists(filepath.Dir(markdownFile.Path)) {
+			if err = markdownFile.resetFolderPage(m); err != nil {
+				appendError(&errors, &errorsMu, err)
+			}
+			continue
+		}
 		_, err = markdownFile.DeletePage(m)
 		if err != nil {
-			errors = append(errors, err)
+			appendError(&errors, &errorsMu, err)
 			continue
 		}
 
-		fmt.Printf("删除文件：%s \n", markdownFile.FormattedPath())
+		if !m.DryRun {
+			fmt.Printf("删除文件：%s \n", markdownFile.FormattedPath())
+		}
 	}
 
 	// 更新文件
@@ -430,7 +693,7 @@ func (m *Markdown2Confluence) GitRun() []error {
 			var err error
 			markdownFile.Ancestor, err = markdownFile.FindOrCreateAncestors(m)
 			if err != nil {
-				errors = append(errors, err)
+				appendError(&errors, &errorsMu, err)
 				continue
 			}
 		}
@@ -445,7 +708,7 @@ func (m *Markdown2Confluence) GitRun() []error {
 			var err error
 			markdownFile.Ancestor, err = markdownFile.FindOrCreateAncestors(m)
 			if err != nil {
-				errors = append(errors, err)
+				appendError(&errors, &errorsMu, err)
 				continue
 			}
 		}
@@ -458,28 +721,99 @@ func (m *Markdown2Confluence) GitRun() []error {
 
 	wg.Wait()
 
+	errors = append(errors, m.orderPages()...)
+
+	if m.Prune {
+		errors = append(errors, m.prune()...)
+	}
+
+	// Failed and skipped files are retried by the next run, which starts from the last recorded commit
+	if len(errors) == 0 && m.conflicts == 0 && m.syncCommit != "" {
+		m.manifest.SetLastCommit(m.syncCommit)
+	}
+
+	if err := m.saveManifest(); err != nil {
+		errors = append(errors, err)
+	}
+
 	return errors
 }
 
-func (m *Markdown2Confluence) queueProcessor(wg *sync.WaitGroup, queue *chan MarkdownFile, errors *[]error) {
+// deletedMarkdownFile returns the MarkdownFile of a source file that no
+// longer exists, so that its page can be found and deleted
+func (m *Markdown2Confluence) deletedMarkdownFile(f string) MarkdownFile {
+	var tempParents []string
+	if m.GitSyncDir != "" {
+		tempParents = deleteFromSlice(strings.Split(filepath.ToSlash(filepath.Dir(strings.TrimPrefix(f, m.GitSyncDir))), "/"), ".")
+	} else {
+		tempParents = deleteFromSlice(strings.Split(filepath.ToSlash(filepath.Dir(f)), "/"), ".")
+	}
+	md := MarkdownFile{
+		Path:    f,
+		Parents: tempParents,
+		Title:   strings.TrimSuffix(filepath.Base(f), ".md"),
+		Space:   m.Space,
+	}
+	if m.isIndexFile(f) && len(tempParents) > 0 {
+		md.Title = tempParents[len(tempParents)-1]
+		md.Parents = tempParents[:len(tempParents)-1]
+	}
+	if m.OrderPages {
+		md.Title = stripOrderPrefix(md.Title)
+		for i := range md.Parents {
+			md.Parents[i] = stripOrderPrefix(md.Parents[i])
+		}
+	}
+
+	if m.Parent != "" {
+		parents := strings.Split(m.Parent, "/")
+		md.Parents = append(parents, md.Parents...)
+		md.Parents = deleteEmpty(md.Parents)
+	}
+	return md
+}
+
+// appendError adds err to errors, which the upload workers share, under mu
+func appendError(errors *[]error, mu *sync.Mutex, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+	*errors = append(*errors, err)
+}
+
+func (m *Markdown2Confluence) queueProcessor(wg *sync.WaitGroup, queue *chan MarkdownFile, errors *[]error, errorsMu *sync.Mutex) {
 	defer wg.Done()
 
 	for markdownFile := range *queue {
 		url, err := markdownFile.Upload(m)
+		if err == errUnchanged {
+			if !m.DryRun {
+				fmt.Printf("无变更：%s --> %s\n", markdownFile.Path, markdownFile.FormattedPath())
+			}
+			continue
+		}
+		if err == errConflictSkipped {
+			continue
+		}
 		if err != nil {
-			*errors = append(*errors, fmt.Errorf("Unable to upload markdown file %s: \n\t%s", markdownFile.Path, err))
+			appendError(errors, errorsMu, fmt.Errorf("Unable to upload markdown file %s: \n\t%s", markdownFile.Path, err))
+		}
+		if m.DryRun {
+			continue
 		}
 		fmt.Printf("上传成功：%s --> %s %s\n", markdownFile.Path, markdownFile.FormattedPath(), url)
 	}
 }
 
-func (m *Markdown2Confluence) addQueueProcessor(wg *sync.WaitGroup, queue *chan MarkdownFile, errors *[]error) {
+func (m *Markdown2Confluence) addQueueProcessor(wg *sync.WaitGroup, queue *chan MarkdownFile, errors *[]error, errorsMu *sync.Mutex) {
 	defer wg.Done()
 
 	for markdownFile := range *queue {
 		url, err := markdownFile.AddPage(m)
 		if err != nil {
-			*errors = append(*errors, fmt.Errorf("Unable to upload markdown file %s: \n\t%s", markdownFile.Path, err))
+			appendError(errors, errorsMu, fmt.Errorf("Unable to upload markdown file %s: \n\t%s", markdownFile.Path, err))
+		}
+		if m.DryRun {
+			continue
 		}
 		if url != "" {
 			fmt.Printf("上传成功：%s --> %s %s\n", markdownFile.Path, markdownFile.FormattedPath(), url)
@@ -496,8 +830,14 @@ func validateInput(s string, msg string) {
 	}
 }
 
-func renderContent(filePath, s string, withHardWraps bool) (content string, images []string, err error) {
-	confluenceExtension := e.NewConfluenceExtension(filePath)
+// renderContent converts the markdown s of f to Confluence storage format
+func (m *Markdown2Confluence) renderContent(f *MarkdownFile, s string) (content string, images []string, err error) {
+	confluenceExtension := e.NewConfluenceExtension(f.Path, m.resolvePage, m.diagramConfig(), m.flavor())
+	withHardWraps := m.WithHardWraps
+	if f.Meta.HardWraps != nil {
+		withHardWraps = *f.Meta.HardWraps
+	}
+
 	ro := goldmark.WithRendererOptions(
 		html.WithXHTML(),
 	)
@@ -508,7 +848,7 @@ func renderContent(filePath, s string, withHardWraps bool) (content string, imag
 		)
 	}
 	md := goldmark.New(
-		goldmark.WithExtensions(extension.GFM, extension.DefinitionList),
+		goldmark.WithExtensions(extension.GFM, extension.DefinitionList, e.NewMathExtension(m.mathMacro())),
 		goldmark.WithParserOptions(
 			parser.WithAutoHeadingID(),
 		),
@@ -519,11 +859,21 @@ func renderContent(filePath, s string, withHardWraps bool) (content string, imag
 	)
 
 	var buf bytes.Buffer
-	if err := md.Convert([]byte(s), &buf); err != nil {
+	ctx := parser.NewContext(parser.WithIDs(e.NewHeadingIDs()))
+	if err := md.Convert([]byte(s), &buf, parser.WithContext(ctx)); err != nil {
+		return "", nil, err
+	}
+
+	for _, warning := range confluenceExtension.Warnings() {
+		fmt.Printf("warning: %s\n", warning)
+	}
+
+	content, err = m.decoratePage(f, buf.String())
+	if err != nil {
 		return "", nil, err
 	}
 
-	return buf.String(), confluenceExtension.Images(), nil
+	return content, confluenceExtension.Images(), nil
 }
 
 func deleteEmpty(s []string) []string {
@@ -546,15 +896,17 @@ func deleteFromSlice(s []string, del string) []string {
 	return s
 }
 
-func getDocumentTitle(p string) string {
-	// Read file to check for the content
-	fileContent, err := ioutil.ReadFile(p)
+// readMarkdownFile returns the front matter and the markdown body of the file p
+func (m *Markdown2Confluence) readMarkdownFile(p string) (FrontMatter, string, error) {
+	fileContent, err := m.readSource(p)
 	if err != nil {
-		log.Fatal(err)
+		return FrontMatter{}, "", err
 	}
-	// Convert []byte to string and print to screen
-	text := string(fileContent)
+	fm, body, err := splitFrontMatter(fileContent)
+	return fm, string(body), err
+}
 
+func getDocumentTitle(text string) string {
 	// check if there is a
 	str := `^#\s+(.+)`
 	r := regexp.MustCompile(str)
@@ -0,0 +1,214 @@
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// orderPrefix matches numeric file name prefixes such as "01-" in 01-intro.md
+var orderPrefix = regexp.MustCompile(`^(\d+)[-_. ]+(.+)$`)
+
+// stripOrderPrefix removes the numeric prefix from a file or folder name
+func stripOrderPrefix(name string) string {
+	if match := orderPrefix.FindStringSubmatch(name); match != nil {
+		return match[2]
+	}
+	return name
+}
+
+// orderedPage is a page whose position among its siblings is set after an upload
+type orderedPage struct {
+	title string
+	// path is the markdown file of the page, empty for folders without an index file
+	path     string
+	weight   int
+	weighted bool
+}
+
+// orderKey returns the position of a page named after the file or folder
+// name: the weight or order of its front matter, or with --order-pages the
+// numeric prefix of the name
+func (m *Markdown2Confluence) orderKey(name string, fm FrontMatter) (int, bool) {
+	if fm.Weight != nil {
+		return *fm.Weight, true
+	}
+	if fm.Order != nil {
+		return *fm.Order, true
+	}
+	if m.OrderPages {
+		if match := orderPrefix.FindStringSubmatch(name); match != nil {
+			n, err := strconv.Atoi(match[1])
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+// indexOrder records the position of the page of md, and of the folder
+// pages above it, among their siblings
+func (m *Markdown2Confluence) indexOrder(md MarkdownFile) {
+	if m.siblings == nil {
+		m.siblings = make(map[string][]orderedPage)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(md.Path), ".md")
+	if m.isIndexFile(md.Path) && strings.Contains(md.Path, "/") {
+		name = filepath.Base(filepath.Dir(md.Path))
+	}
+	weight, weighted := m.orderKey(name, md.Meta)
+	m.addSibling(md.space(m), md.Parents, orderedPage{title: md.Title, path: md.Path, weight: weight, weighted: weighted})
+
+	offset := len(md.Parents) - len(md.parentDirs)
+	for i, dir := range md.parentDirs {
+		weight, weighted := m.orderKey(filepath.Base(dir), FrontMatter{})
+		m.addSibling(md.space(m), md.Parents[:offset+i], orderedPage{title: md.Parents[offset+i], weight: weight, weighted: weighted})
+	}
+}
+
+// addSibling adds page to the pages below parents, merging it with the
+// entry of the same title. The entry of an index file wins over the one
+// of its folder, unless it has no weight of its own.
+func (m *Markdown2Confluence) addSibling(space string, parents []string, page orderedPage) {
+	key := space + ":" + strings.Join(parents, "/")
+	for i, sibling := range m.siblings[key] {
+		if sibling.title != page.title {
+			continue
+		}
+		if sibling.path == "" && page.path != "" {
+			if !page.weighted {
+				page.weight, page.weighted = sibling.weight, sibling.weighted
+			}
+			m.siblings[key][i] = page
+		}
+		return
+	}
+	m.siblings[key] = append(m.siblings[key], page)
+}
+
+// orderPages moves the pages of each folder into the order of their weights
+// and file name prefixes. Pages without one follow in title order.
+func (m *Markdown2Confluence) orderPages() []error {
+	var errors []error
+
+	keys := make([]string, 0, len(m.siblings))
+	for key := range m.siblings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		pages := m.siblings[key]
+		weighted := false
+		for _, p := range pages {
+			weighted = weighted || p.weighted
+		}
+		if len(pages) < 2 || !weighted {
+			continue
+		}
+		sort.SliceStable(pages, func(i, j int) bool {
+			a, b := pages[i], pages[j]
+			if a.weighted != b.weighted {
+				return a.weighted
+			}
+			if a.weighted && a.weight != b.weight {
+				return a.weight < b.weight
+			}
+			return a.title < b.title
+		})
+
+		parts := strings.SplitN(key, ":", 2)
+		if err := m.orderSiblings(parts[0], deleteEmpty(strings.Split(parts[1], "/")), pages); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	return errors
+}
+
+// orderSiblings moves pages, the children of the page at the end of
+// parents, into the given order unless they already are in it
+func (m *Markdown2Confluence) orderSiblings(space string, parents []string, pages []orderedPage) error {
+	var titles, ids []string
+	for _, p := range pages {
+		titles = append(titles, p.title)
+		id, err := m.orderedPageID(space, parents, p)
+		if err != nil {
+			return err
+		}
+		// Pages that were not published, e.g. after an error, are left out
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == len(pages) {
+		var parentID string
+		if len(parents) > 0 {
+			var err error
+			if parentID, err = m.orderedPageID(space, parents[:len(parents)-1], orderedPage{title: parents[len(parents)-1]}); err != nil {
+				return err
+			}
+		}
+		if !strings.HasPrefix(parentID, dryRunPrefix) && (parentID != "" || len(parents) == 0) {
+			children, err := m.client.GetChildPageIDs(space, parentID)
+			if err != nil {
+				return fmt.Errorf("Error reading child pages of %s: %s", strings.Join(parents, "/"), err)
+			}
+			if inOrder(children, ids) {
+				return nil
+			}
+		}
+	}
+
+	if m.DryRun {
+		m.Plan.Add(PlanAction{Kind: PlanOrder, Title: strings.Join(parents, "/"), Detail: strings.Join(titles, ", ")})
+		return nil
+	}
+	if len(ids) < 2 {
+		return nil
+	}
+
+	for i := 1; i < len(ids); i++ {
+		if err := m.client.MovePage(ids[i], "after", ids[i-1]); err != nil {
+			return fmt.Errorf("Error ordering pages below %s: %s", strings.Join(parents, "/"), err)
+		}
+	}
+	fmt.Printf("排序成功：%s --> %s\n", strings.Join(parents, "/"), strings.Join(titles, ", "))
+	return nil
+}
+
+// orderedPageID returns the ID of the page p below parents, or an empty
+// string if it does not exist
+func (m *Markdown2Confluence) orderedPageID(space string, parents []string, p orderedPage) (string, error) {
+	if p.path != "" {
+		if e, ok := m.manifest.Get(p.path); ok {
+			return e.PageID, nil
+		}
+	}
+	if id, ok := cachedParent(space + ":" + strings.Join(append(parents[:len(parents):len(parents)], p.title), "/")); ok {
+		return id, nil
+	}
+
+	content, err := m.findSpacePage(space, p.title, nil)
+	if err != nil {
+		return "", fmt.Errorf("Error searching for page %s: %s", p.title, err)
+	}
+	if content == nil {
+		return "", nil
+	}
+	return content.ID, nil
+}
+
+// inOrder reports whether ids appear in children in the same order
+func inOrder(children, ids []string) bool {
+	i := 0
+	for _, child := range children {
+		if i < len(ids) && child == ids[i] {
+			i++
+		}
+	}
+	return i == len(ids)
+}
@@ -0,0 +1,113 @@
+package lib
+
+import "testing"
+
+func TestStripOrderPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "01-intro", want: "intro"},
+		{name: "2_setup", want: "setup"},
+		{name: "10. Advanced topics", want: "Advanced topics"},
+		{name: "003 - FAQ", want: "FAQ"},
+		{name: "intro", want: "intro"},
+		{name: "2021", want: "2021"},
+		{name: "2021-", want: "2021-"},
+		{name: "v2-api", want: "v2-api"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripOrderPrefix(tt.name); got != tt.want {
+				t.Errorf("stripOrderPrefix(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderKey(t *testing.T) {
+	one, five := 1, 5
+
+	tests := []struct {
+		name       string
+		file       string
+		fm         FrontMatter
+		orderPages bool
+		weight     int
+		weighted   bool
+	}{
+		{name: "prefix", file: "03-setup", orderPages: true, weight: 3, weighted: true},
+		{name: "prefix without --order-pages", file: "03-setup"},
+		{name: "no prefix", file: "setup", orderPages: true},
+		{name: "weight wins over the prefix", file: "03-setup", fm: FrontMatter{Weight: &five}, orderPages: true, weight: 5, weighted: true},
+		{name: "weight wins over order", file: "setup", fm: FrontMatter{Weight: &five, Order: &one}, weight: 5, weighted: true},
+		{name: "order", file: "setup", fm: FrontMatter{Order: &one}, weight: 1, weighted: true},
+		{name: "prefix too large", file: "99999999999999999999-setup", orderPages: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Markdown2Confluence{OrderPages: tt.orderPages}
+			weight, weighted := m.orderKey(tt.file, tt.fm)
+			if weighted != tt.weighted || (weighted && weight != tt.weight) {
+				t.Errorf("orderKey(%q) = %d, %v, want %d, %v", tt.file, weight, weighted, tt.weight, tt.weighted)
+			}
+		})
+	}
+}
+
+func TestInOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		children []string
+		ids      []string
+		want     bool
+	}{
+		{name: "same order", children: []string{"1", "2", "3"}, ids: []string{"1", "2", "3"}, want: true},
+		{name: "other pages in between", children: []string{"1", "9", "2", "8", "3"}, ids: []string{"1", "2", "3"}, want: true},
+		{name: "swapped", children: []string{"2", "1", "3"}, ids: []string{"1", "2", "3"}},
+		{name: "missing page", children: []string{"1", "3"}, ids: []string{"1", "2", "3"}},
+		{name: "no pages", children: []string{"1"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inOrder(tt.children, tt.ids); got != tt.want {
+				t.Errorf("inOrder(%v, %v) = %v, want %v", tt.children, tt.ids, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderPagesTies(t *testing.T) {
+	key := "DOCS:Guide"
+	cacheParent(key, dryRunID("Guide"))
+	defer func() {
+		parentIndexMu.Lock()
+		delete(ParentIndex, key)
+		parentIndexMu.Unlock()
+	}()
+
+	m := Markdown2Confluence{DryRun: true, Plan: new(Plan), manifest: emptyManifest(), siblings: make(map[string][]orderedPage)}
+	pages := []orderedPage{
+		{title: "c", path: "guide/c.md", weight: 2, weighted: true},
+		{title: "e", path: "guide/e.md"},
+		{title: "a", path: "guide/a.md", weight: 1, weighted: true},
+		{title: "b", path: "guide/b.md"},
+		{title: "d", path: "guide/d.md", weight: 2, weighted: true},
+	}
+	for i, p := range pages {
+		m.manifest.Set(p.path, ManifestEntry{PageID: string(rune('1' + i))})
+		m.addSibling("DOCS", []string{"Guide"}, p)
+	}
+	// A folder page is merged with the page of its index file of the same title
+	m.addSibling("DOCS", []string{"Guide"}, orderedPage{title: "a", weight: 9, weighted: true})
+
+	if errs := m.orderPages(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(m.Plan.Actions) != 1 || m.Plan.Actions[0].Detail != "a, c, d, b, e" {
+		t.Errorf("plan = %v, want the pages ordered a, c, d, b, e", m.Plan.Actions)
+	}
+}
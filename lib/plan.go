@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Kinds of actions recorded in a Plan
+const (
+	PlanCreate       = "create"
+	PlanUpdate       = "update"
+	PlanMove         = "move"
+	PlanRename       = "rename"
+	PlanCreateParent = "create parent"
+	PlanCreateFolder = "create folder"
+	PlanAttach       = "attach"
+	PlanConvert      = "convert"
+	PlanLabel        = "label"
+	PlanProperty     = "property"
+	PlanDelete       = "delete"
+	PlanConflict     = "conflict"
+	PlanPull         = "pull"
+	PlanOrder        = "order"
+)
+
+// PlanAction describes a single write a sync would perform on Confluence
+type PlanAction struct {
+	Kind   string
+	Title  string
+	Path   string
+	Detail string
+}
+
+func (a PlanAction) String() string {
+	s := fmt.Sprintf("%-14s %s", a.Kind, a.Title)
+	if a.Path != "" {
+		s = s + " (" + a.Path + ")"
+	}
+	if a.Detail != "" {
+		s = s + ": " + a.Detail
+	}
+	return s
+}
+
+// Plan collects the actions of a dry run instead of executing them
+type Plan struct {
+	mu      sync.Mutex
+	Actions []PlanAction
+}
+
+// Add records an action. It is safe to call from the upload workers.
+func (p *Plan) Add(a PlanAction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Actions = append(p.Actions, a)
+}
+
+// Print writes the plan in the order the actions were recorded
+func (p *Plan) Print(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintln(w, "---------------------------执行计划--------------------------")
+	if len(p.Actions) == 0 {
+		fmt.Fprintln(w, "No changes.")
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, a := range p.Actions {
+		fmt.Fprintln(w, a.String())
+		counts[a.Kind]++
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Plan: %d to create, %d to update, %d to move, %d parent pages to create, %d attachments to upload, %d to delete.\n",
+		counts[PlanCreate], counts[PlanUpdate], counts[PlanMove], counts[PlanCreateParent], counts[PlanAttach], counts[PlanDelete])
+}
+
+// dryRunPrefix marks placeholder IDs handed out for pages a dry run would create
+const dryRunPrefix = "dry-run:"
+
+// dryRunID returns a placeholder page ID for a page that would be created
+func dryRunID(title string) string {
+	return dryRunPrefix + title
+}
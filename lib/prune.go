@@ -0,0 +1,207 @@
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/justmiles/go-confluence"
+)
+
+// DefaultPruneLimit is the number of pages --prune may remove in one run
+const DefaultPruneLimit = 20
+
+// prune deletes, or moves to the archive page, every page below --parent
+// that no longer has a source file in the sync set
+func (m *Markdown2Confluence) prune() []error {
+	root := MarkdownFile{Parents: deleteEmpty(strings.Split(m.Parent, "/")), Space: m.Space}
+	if len(root.Parents) == 0 {
+		return []error{fmt.Errorf("--prune requires --parent")}
+	}
+	rootID, err := root.FindOrCreateAncestors(m)
+	if err != nil {
+		return []error{err}
+	}
+	if strings.HasPrefix(rootID, dryRunPrefix) {
+		// The parent page does not exist yet, so there is nothing to prune
+		return nil
+	}
+
+	// Stale folders are deleted along with their pages, but can not be archived
+	types := "type = page"
+	if m.useFolders() && m.PruneArchive == "" {
+		types = "type in (page, folder)"
+	}
+	descendants, err := m.client.SearchContent(fmt.Sprintf("ancestor = %s and %s", rootID, types), []string{"ancestors", "version"})
+	if err != nil {
+		return []error{fmt.Errorf("Error listing pages below %s: %s", m.Parent, err)}
+	}
+
+	var archiveID string
+	archived := make(map[string]bool)
+	if m.PruneArchive != "" {
+		archive := MarkdownFile{Parents: append(append([]string{}, root.Parents...), m.PruneArchive), Space: m.Space}
+		archiveID, err = archive.FindOrCreateAncestors(m)
+		if err != nil {
+			return []error{err}
+		}
+		archived[archiveID] = true
+		if !strings.HasPrefix(archiveID, dryRunPrefix) {
+			pages, err := m.client.SearchContent(fmt.Sprintf("ancestor = %s and type = page", archiveID), nil)
+			if err != nil {
+				return []error{fmt.Errorf("Error listing archived pages: %s", err)}
+			}
+			for _, page := range pages {
+				archived[page.ID] = true
+			}
+		}
+	}
+
+	keepIDs := make(map[string]bool)
+	for p, e := range m.manifest.Entries() {
+		if abs, err := filepath.Abs(filepath.FromSlash(p)); err == nil {
+			if _, ok := m.pages[abs]; ok {
+				keepIDs[e.PageID] = true
+			}
+		}
+	}
+
+	// Folder pages found or created by this run are kept by ID as well
+	for _, id := range ParentIndex {
+		keepIDs[id] = true
+	}
+
+	titles := make(map[string]string)
+	for _, page := range descendants {
+		titles[page.ID] = page.Title
+	}
+
+	candidates := make(map[string]confluence.Content)
+	for _, page := range descendants {
+		if archived[page.ID] || keepIDs[page.ID] || m.keepPage(page.Title) {
+			continue
+		}
+		// Other pages are kept when a file or folder of the sync set is
+		// published at the same place, below the same parents
+		path, ok := prunePath(root.Parents, rootID, page, titles)
+		if !ok || m.syncPaths[pagePathKey(m.Space, path)] {
+			continue
+		}
+		candidates[page.ID] = page
+	}
+
+	// Removing a page takes its subtree along, so only the topmost stale pages are handled
+	var stale []confluence.Content
+	for _, page := range descendants {
+		if _, ok := candidates[page.ID]; !ok {
+			continue
+		}
+		nested := false
+		for _, ancestor := range page.Ancestors {
+			if _, ok := candidates[ancestor.ID]; ok {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			stale = append(stale, page)
+		}
+	}
+
+	if len(candidates) > m.PruneLimit {
+		var titles []string
+		for _, page := range candidates {
+			titles = append(titles, page.Title)
+		}
+		return []error{fmt.Errorf("refusing to prune %d pages, --prune-limit is %d:\n\t%s", len(candidates), m.PruneLimit, strings.Join(titles, "\n\t"))}
+	}
+
+	var errors []error
+	for _, page := range stale {
+		if m.DryRun {
+			if archiveID != "" {
+				m.Plan.Add(PlanAction{Kind: PlanMove, Title: page.Title, Detail: "page " + page.ID + " to " + describeParent(archiveID)})
+			} else {
+				m.Plan.Add(PlanAction{Kind: PlanDelete, Title: page.Title, Detail: "page " + page.ID + " has no source file"})
+			}
+			continue
+		}
+
+		if archiveID != "" {
+			if err := m.archivePage(page.ID, archiveID); err != nil {
+				errors = append(errors, fmt.Errorf("Error archiving page %s: %s", page.Title, err))
+				continue
+			}
+			fmt.Printf("归档页面：%s\n", page.Title)
+		} else {
+			if err := m.client.DeleteContent(page); err != nil {
+				errors = append(errors, fmt.Errorf("Error deleting page %s: %s", page.Title, err))
+				continue
+			}
+			fmt.Printf("删除页面：%s\n", page.Title)
+		}
+	}
+	return errors
+}
+
+// prunePath returns the titles of the pages from the top of the space down
+// to page, which is below the page rootID at the end of parents. It is not
+// known when one of the pages in between was not listed.
+func prunePath(parents []string, rootID string, page confluence.Content, titles map[string]string) ([]string, bool) {
+	below := -1
+	for i, ancestor := range page.Ancestors {
+		if ancestor.ID == rootID {
+			below = i + 1
+			break
+		}
+	}
+	if below < 0 {
+		return nil, false
+	}
+
+	path := append([]string{}, parents...)
+	for _, ancestor := range page.Ancestors[below:] {
+		title, ok := titles[ancestor.ID]
+		if !ok {
+			return nil, false
+		}
+		path = append(path, title)
+	}
+	return append(path, page.Title), true
+}
+
+// pagePathKey identifies the page at path, its title and those of its
+// parents, in space
+func pagePathKey(space string, path []string) string {
+	return space + ":" + strings.Join(path, "/")
+}
+
+// archivePage moves the page with the given ID below the archive page
+func (m *Markdown2Confluence) archivePage(id, archiveID string) error {
+	content, err := m.client.GetContentByID(id, []string{"version", "body.storage"})
+	if err != nil {
+		return err
+	}
+	if content == nil {
+		return nil
+	}
+	content.Version.Number++
+	content.Version.Message = m.Comment
+	content.Ancestors = nil
+	content.Ancestors = append(content.Ancestors, Ancestor{
+		ID: archiveID,
+	})
+	_, err = m.client.UpdateContent(content, nil)
+	return err
+}
+
+// keepPage reports whether a page title matches one of the --prune-keep patterns
+func (m *Markdown2Confluence) keepPage(title string) bool {
+	for _, pattern := range m.PruneKeep {
+		if regexp.MustCompile(pattern).MatchString(title) {
+			return true
+		}
+	}
+	return false
+}
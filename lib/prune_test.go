@@ -0,0 +1,53 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/justmiles/go-confluence"
+)
+
+func TestPrunePath(t *testing.T) {
+	page := func(title string, ancestors ...string) confluence.Content {
+		var c confluence.Content
+		c.Title = title
+		for _, id := range ancestors {
+			c.Ancestors = append(c.Ancestors, Ancestor{ID: id})
+		}
+		return c
+	}
+	titles := map[string]string{"10": "Docs", "11": "guide", "12": "api"}
+
+	tests := []struct {
+		name string
+		page confluence.Content
+		path []string
+		ok   bool
+	}{
+		{"direct child", page("intro", "1", "10"), []string{"Space", "Docs", "intro"}, true},
+		{"nested", page("setup", "1", "10", "11"), []string{"Space", "Docs", "guide", "setup"}, true},
+		{"same title in another folder", page("setup", "1", "10", "12"), []string{"Space", "Docs", "api", "setup"}, true},
+		{"unlisted page in between", page("x", "1", "10", "99"), nil, false},
+		{"not below the root", page("x", "1"), nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, ok := prunePath([]string{"Space", "Docs"}, "10", tt.page, titles)
+			if ok != tt.ok || !reflect.DeepEqual(path, tt.path) {
+				t.Errorf("prunePath = %v, %v, want %v, %v", path, ok, tt.path, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidatePruneRequiresDirectories(t *testing.T) {
+	m := Markdown2Confluence{Space: "S", Username: "u", Password: "p", Endpoint: "https://example.com", Parent: "Docs", Prune: true}
+	m.SourceMarkdown = []string{"frontmatter.go"}
+	if err := m.Validate(); err == nil {
+		t.Errorf("expected --prune with a file to be refused")
+	}
+	m.SourceMarkdown = []string{"."}
+	if err := m.Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
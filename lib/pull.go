@@ -0,0 +1,285 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/justmiles/go-confluence"
+	"gopkg.in/yaml.v2"
+
+	"markdownToConfluence/lib/storage"
+)
+
+// pulledPage is a page of the pulled subtree and the markdown file it is written to
+type pulledPage struct {
+	Page
+	path     string
+	children []*pulledPage
+}
+
+// pulledFrontMatter is the front matter written for pulled pages
+type pulledFrontMatter struct {
+	Title  string     `yaml:"title,omitempty"`
+	Labels []string   `yaml:"labels,omitempty"`
+	Toc    *TocConfig `yaml:"toc,omitempty"`
+}
+
+// assetsSuffix is appended to the markdown file name, without .md, to get
+// the directory the attachments of a pulled page are written to
+const assetsSuffix = ".assets"
+
+// unsafeFileName matches characters that can not be used in file names
+var unsafeFileName = strings.NewReplacer("/", "-", "\\", "-", ":", "-", "*", "-", "?", "-", "\"", "-", "<", "-", ">", "-", "|", "-")
+
+// Pull writes the page with the given ID and all pages below it as markdown
+// files into directory. A page with children becomes a folder holding an
+// index file, the same layout an upload turns back into the page tree.
+func (m *Markdown2Confluence) Pull(pageID, directory string) []error {
+	if err := m.CreateClient(); err != nil {
+		return []error{err}
+	}
+	if err := m.loadManifest(); err != nil {
+		return []error{err}
+	}
+
+	if pageID == "" {
+		parents := deleteEmpty(strings.Split(m.Parent, "/"))
+		if len(parents) == 0 {
+			return []error{fmt.Errorf("pull requires --page-id or --parent")}
+		}
+		contentResults, err := m.client.GetContent(&confluence.GetContentQueryParameters{
+			Title:    parents[len(parents)-1],
+			Spacekey: m.Space,
+			Limit:    1,
+			Type:     "page",
+		})
+		if err != nil {
+			return []error{fmt.Errorf("Error searching for page %s: %s", m.Parent, err)}
+		}
+		if len(contentResults) == 0 {
+			return []error{fmt.Errorf("page %s does not exist in space %s", m.Parent, m.Space)}
+		}
+		pageID = contentResults[0].ID
+	}
+
+	page, err := m.client.GetPage(pageID)
+	if err != nil {
+		return []error{fmt.Errorf("Error reading page %s: %s", pageID, err)}
+	}
+	if m.Space == "" {
+		m.Space = page.Space.Key
+	}
+
+	root := &pulledPage{Page: *page}
+	if err := m.pullChildren(root); err != nil {
+		return []error{err}
+	}
+
+	titles := make(map[string]string)
+	assignPullPaths(root, directory, m.indexFiles()[0], map[string]bool{}, titles)
+
+	var errors []error
+	m.writePulledPage(root, titles, &errors)
+	if err := m.saveManifest(); err != nil {
+		errors = append(errors, err)
+	}
+	return errors
+}
+
+// pullChildren reads the subtree below p
+func (m *Markdown2Confluence) pullChildren(p *pulledPage) error {
+	children, err := m.client.GetChildPages(p.ID)
+	if err != nil {
+		return fmt.Errorf("Error reading child pages of %s: %s", p.Title, err)
+	}
+	for _, child := range children {
+		c := &pulledPage{Page: child}
+		if err := m.pullChildren(c); err != nil {
+			return err
+		}
+		p.children = append(p.children, c)
+	}
+	return nil
+}
+
+// assignPullPaths chooses the markdown file of p and its descendants. Pages
+// with children are written to the index file of their folder, Confluence
+// folders become folders without one. taken holds
+// the lower case names already used in directory, titles collects the file
+// of every page keyed by space and title.
+func assignPullPaths(p *pulledPage, directory, index string, taken map[string]bool, titles map[string]string) {
+	name := unsafeFileName.Replace(strings.TrimSpace(p.Title))
+	// The index file stands for the folder it is in, so no page may use it
+	// as a file name, nor the name of its attachments directory
+	indexAssets := strings.TrimSuffix(index, ".md") + assetsSuffix
+	if name == "" || strings.EqualFold(name+".md", index) || strings.EqualFold(name, indexAssets) ||
+		taken[strings.ToLower(name)] || taken[strings.ToLower(name+assetsSuffix)] {
+		name = name + " (" + p.ID + ")"
+	}
+	taken[strings.ToLower(name)] = true
+	taken[strings.ToLower(name+assetsSuffix)] = true
+
+	if p.Type == "folder" {
+		// A Confluence folder has no content of its own, so it gets no index file
+		p.path = filepath.Join(directory, name)
+		inFolder := make(map[string]bool)
+		for _, child := range p.children {
+			assignPullPaths(child, p.path, index, inFolder, titles)
+		}
+		return
+	}
+
+	if len(p.children) == 0 {
+		p.path = filepath.Join(directory, name+".md")
+	} else {
+		folder := filepath.Join(directory, name)
+		p.path = filepath.Join(folder, index)
+		inFolder := make(map[string]bool)
+		for _, child := range p.children {
+			assignPullPaths(child, folder, index, inFolder, titles)
+		}
+	}
+	titles[p.Space.Key+":"+p.Title] = p.path
+}
+
+// writePulledPage converts p to markdown, writes it with its attachments
+// and continues with its children
+func (m *Markdown2Confluence) writePulledPage(p *pulledPage, titles map[string]string, errors *[]error) {
+	if p.Type == "folder" {
+		if err := m.writePulledFolder(p); err != nil {
+			*errors = append(*errors, err)
+		}
+		for _, child := range p.children {
+			m.writePulledPage(child, titles, errors)
+		}
+		return
+	}
+
+	converter := storage.Converter{
+		Attachments: filepath.Base(pulledAssets(p.path)),
+		Resolve: func(title, space string) string {
+			if space == "" {
+				space = p.Space.Key
+			}
+			if target, ok := titles[space+":"+title]; ok {
+				if rel, err := filepath.Rel(filepath.Dir(p.path), target); err == nil {
+					return filepath.ToSlash(rel)
+				}
+			}
+			return m.client.Endpoint + "/display/" + url.PathEscape(space) + "/" + url.PathEscape(title)
+		},
+	}
+
+	body, err := converter.Convert(m.undecoratePage(p.Body.Storage.Value))
+	for _, warning := range converter.Warnings {
+		fmt.Printf("warning: %s: %s\n", p.Title, warning)
+	}
+	if err != nil {
+		*errors = append(*errors, fmt.Errorf("Unable to convert page %s: %s", p.Title, err))
+	} else {
+		var fm pulledFrontMatter
+		fm.Labels = p.Labels()
+		// Pages get the table of contents of .confluence.json again on upload
+		if converter.Toc && !m.Toc.Enabled {
+			fm.Toc = &TocConfig{Enabled: true, Style: converter.TocParams["style"]}
+			fm.Toc.MinLevel, _ = strconv.Atoi(converter.TocParams["minLevel"])
+			fm.Toc.MaxLevel, _ = strconv.Atoi(converter.TocParams["maxLevel"])
+		}
+		if m.derivedTitle(p.path) != p.Title {
+			fm.Title = p.Title
+		}
+		if err := m.writePulledFile(p, fm, body); err != nil {
+			*errors = append(*errors, err)
+		}
+	}
+
+	for _, child := range p.children {
+		m.writePulledPage(child, titles, errors)
+	}
+}
+
+// writePulledFile writes the markdown file of p and downloads its
+// attachments into a directory of its own, so that attachments of the same
+// name on different pages do not overwrite each other
+func (m *Markdown2Confluence) writePulledFile(p *pulledPage, fm pulledFrontMatter, body string) error {
+	if m.DryRun {
+		m.Plan.Add(PlanAction{Kind: PlanPull, Title: p.Title, Path: p.path, Detail: "page " + p.ID})
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if fm.Title != "" || len(fm.Labels) > 0 || fm.Toc != nil {
+		header, err := yaml.Marshal(fm)
+		if err != nil {
+			return err
+		}
+		buf.WriteString("---\n")
+		buf.Write(header)
+		buf.WriteString("---\n\n")
+	}
+	buf.WriteString(body)
+
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return fmt.Errorf("Error creating directory for %s: %s", p.path, err)
+	}
+	if err := ioutil.WriteFile(p.path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Error writing %s: %s", p.path, err)
+	}
+
+	if _, err := m.client.DownloadAttachments(p.ID, pulledAssets(p.path)); err != nil {
+		return fmt.Errorf("Error downloading attachments of %s: %s", p.Title, err)
+	}
+
+	// Later uploads update this page, and detect edits made in Confluence after the pull
+	var parentID string
+	if len(p.Ancestors) > 0 {
+		parentID = p.Ancestors[len(p.Ancestors)-1].ID
+	}
+	m.manifest.Set(p.path, ManifestEntry{
+		PageID:   p.ID,
+		Title:    p.Title,
+		ParentID: parentID,
+		Version:  p.Version.Number,
+	})
+
+	fmt.Printf("下载成功：%s --> %s\n", p.Title, p.path)
+	return nil
+}
+
+// writePulledFolder creates the directory of the Confluence folder p, which
+// an upload with the v2 API turns back into the folder
+func (m *Markdown2Confluence) writePulledFolder(p *pulledPage) error {
+	if m.DryRun {
+		m.Plan.Add(PlanAction{Kind: PlanPull, Title: p.Title, Path: p.path, Detail: "folder " + p.ID})
+		return nil
+	}
+	if err := os.MkdirAll(p.path, 0755); err != nil {
+		return fmt.Errorf("Error creating directory for %s: %s", p.Title, err)
+	}
+	fmt.Printf("下载成功：%s --> %s\n", p.Title, p.path)
+	return nil
+}
+
+// pulledAssets returns the directory the attachments of the page pulled to
+// the markdown file p are written to, e.g. docs/Page.assets for docs/Page.md
+func pulledAssets(p string) string {
+	return strings.TrimSuffix(p, ".md") + assetsSuffix
+}
+
+// derivedTitle returns the title an upload derives from the file name of p
+func (m *Markdown2Confluence) derivedTitle(p string) string {
+	title := strings.TrimSuffix(filepath.Base(p), ".md")
+	if m.isIndexFile(p) {
+		title = filepath.Base(filepath.Dir(p))
+	}
+	if m.OrderPages {
+		title = stripOrderPrefix(title)
+	}
+	return title
+}
@@ -0,0 +1,77 @@
+package renderer
+
+import (
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+
+	cast "markdownToConfluence/lib/extension/ast"
+)
+
+// admonitionMacros maps admonition types of GitHub alerts and MkDocs to Confluence panel macros
+var admonitionMacros = map[string]string{
+	"note":      "info",
+	"info":      "info",
+	"abstract":  "info",
+	"summary":   "info",
+	"tldr":      "info",
+	"question":  "info",
+	"example":   "info",
+	"quote":     "info",
+	"tip":       "tip",
+	"hint":      "tip",
+	"success":   "tip",
+	"check":     "tip",
+	"done":      "tip",
+	"important": "note",
+	"attention": "note",
+	"warning":   "warning",
+	"caution":   "warning",
+	"danger":    "warning",
+	"error":     "warning",
+	"failure":   "warning",
+	"bug":       "warning",
+}
+
+// ConfluenceAdmonitionHTMLRender is a renderer.NodeRenderer implementation that
+// renders Admonition nodes as Confluence info, tip, note and warning panels.
+type ConfluenceAdmonitionHTMLRender struct {
+	html.Config
+}
+
+// NewConfluenceAdmonitionHTMLRender returns a new ConfluenceAdmonitionHTMLRender.
+func NewConfluenceAdmonitionHTMLRender(opts ...html.Option) renderer.NodeRenderer {
+	r := &ConfluenceAdmonitionHTMLRender{
+		Config: html.NewConfig(),
+	}
+	for _, opt := range opts {
+		opt.SetHTMLOption(&r.Config)
+	}
+	return r
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (r *ConfluenceAdmonitionHTMLRender) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(cast.KindAdmonition, r.renderAdmonition)
+}
+
+func (r *ConfluenceAdmonitionHTMLRender) renderAdmonition(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*cast.Admonition)
+	if entering {
+		macro, ok := admonitionMacros[n.AdmonitionType]
+		if !ok {
+			macro = "info"
+		}
+		_, _ = w.WriteString(`<ac:structured-macro ac:name="` + macro + `" ac:schema-version="1">`)
+		if len(n.Title) > 0 {
+			_, _ = w.WriteString(`<ac:parameter ac:name="title">`)
+			_, _ = w.Write(util.EscapeHTML(n.Title))
+			_, _ = w.WriteString(`</ac:parameter>`)
+		}
+		_, _ = w.WriteString(`<ac:rich-text-body>`)
+	} else {
+		_, _ = w.WriteString("</ac:rich-text-body></ac:structured-macro>\n")
+	}
+	return ast.WalkContinue, nil
+}
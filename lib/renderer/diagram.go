@@ -0,0 +1,201 @@
+package renderer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/goldmark/util"
+)
+
+// Diagram configures how fences of a diagram language, e.g. ```mermaid, are
+// rendered. With Macro the source becomes the body of that Confluence app
+// macro, with Command it is converted to an image that is attached to the page.
+type Diagram struct {
+	// Macro is the name of the app macro, e.g. "plantuml"
+	Macro string
+	// Command converts the source to an image, e.g. "dot -Tsvg". The source
+	// is passed on stdin and the image read from stdout, unless the command
+	// contains the {input} and {output} placeholders for file names. It is
+	// split into arguments like a shell does, without running one.
+	Command string
+	// Format is the image format the command produces, svg (default) or png
+	Format string
+}
+
+// DiagramConfig configures the diagram languages and where converted images are cached
+type DiagramConfig struct {
+	Languages map[string]Diagram
+	CacheDir  string
+	// DryRun leaves diagrams that are not cached unconverted
+	DryRun bool
+}
+
+// Args splits Command into the program and its arguments. Arguments may be
+// quoted with single or double quotes, and a backslash escapes the next
+// character outside single quotes.
+func (d Diagram) Args() ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range d.Command {
+		switch {
+		case escaped:
+			arg.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in command %q", d.Command)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// renderDiagram writes the source of a fence of language lang as configured by d
+func (r *ConfluenceFencedCodeBlockHTMLRender) renderDiagram(w util.BufWriter, lang string, d Diagram, src []byte) error {
+	if d.Command == "" {
+		_, _ = w.WriteString(`<ac:structured-macro ac:name="` + d.Macro + `" ac:schema-version="1"><ac:plain-text-body><![CDATA[`)
+		_, _ = w.WriteString(strings.Replace(string(src), "]]>", "]]]]><![CDATA[>", -1))
+		_, _ = w.WriteString("]]></ac:plain-text-body></ac:structured-macro>\n")
+		return nil
+	}
+
+	image, err := r.convertDiagram(lang, d, src)
+	if err != nil {
+		return fmt.Errorf("unable to render %s diagram: %s", lang, err)
+	}
+	// The same diagram may appear more than once on a page, it is attached once
+	attached := false
+	for _, i := range r.Images {
+		attached = attached || i == image
+	}
+	if !attached {
+		r.Images = append(r.Images, image)
+	}
+	_, _ = w.WriteString(`<ac:image><ri:attachment ri:filename="`)
+	_, _ = w.WriteString(filepath.Base(image))
+	_, _ = w.WriteString("\"/></ac:image>\n")
+	return nil
+}
+
+// convertDiagram runs the converter command of d on src and returns the
+// image file. Images are cached by the hash of the command and the source,
+// so an unchanged diagram is not converted again and keeps its file name.
+// In a dry run the file name is returned without converting the diagram.
+func (r *ConfluenceFencedCodeBlockHTMLRender) convertDiagram(lang string, d Diagram, src []byte) (string, error) {
+	format := d.Format
+	if format == "" {
+		format = "svg"
+	}
+
+	h := sha256.New()
+	h.Write([]byte(d.Command + "\x00" + format + "\x00"))
+	h.Write(src)
+	cacheDir, err := filepath.Abs(r.Diagrams.CacheDir)
+	if err != nil {
+		return "", err
+	}
+	image := filepath.Join(cacheDir, lang+"-"+hex.EncodeToString(h.Sum(nil))[:16]+"."+format)
+	if _, err := os.Stat(image); err == nil || r.Diagrams.DryRun {
+		return image, nil
+	}
+
+	args, err := d.Args()
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("blank command")
+	}
+
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", err
+	}
+	// Write to a temporary file first, so a failed conversion is not cached
+	tmp, err := ioutil.TempFile(cacheDir, ".diagram-*")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	var input string
+	for i, arg := range args {
+		if strings.Contains(arg, "{input}") && input == "" {
+			f, err := ioutil.TempFile("", "diagram-*."+lang)
+			if err != nil {
+				return "", err
+			}
+			input = f.Name()
+			defer os.Remove(input)
+			_, err = f.Write(src)
+			f.Close()
+			if err != nil {
+				return "", err
+			}
+		}
+		arg = strings.Replace(arg, "{input}", input, -1)
+		args[i] = strings.Replace(arg, "{output}", tmp.Name()+"."+format, -1)
+	}
+	toFile := strings.Contains(d.Command, "{output}")
+	if toFile {
+		defer os.Remove(tmp.Name() + "." + format)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	// Diagrams may include other files relative to the markdown file
+	cmd.Dir = filepath.Dir(r.filePath)
+	if input == "" {
+		cmd.Stdin = bytes.NewReader(src)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %s %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	if toFile {
+		err = os.Rename(tmp.Name()+"."+format, image)
+	} else if stdout.Len() == 0 {
+		err = fmt.Errorf("%s produced no output", args[0])
+	} else if err = ioutil.WriteFile(tmp.Name(), stdout.Bytes(), 0644); err == nil {
+		err = os.Rename(tmp.Name(), image)
+	}
+	if err != nil {
+		return "", err
+	}
+	return image, nil
+}
@@ -0,0 +1,122 @@
+package renderer
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+func TestDiagramArgs(t *testing.T) {
+	tests := []struct {
+		command string
+		args    []string
+		err     bool
+	}{
+		{command: "dot -Tsvg", args: []string{"dot", "-Tsvg"}},
+		{command: "  mmdc\t-i {input}  -o {output} ", args: []string{"mmdc", "-i", "{input}", "-o", "{output}"}},
+		{command: `convert -o "out file.svg"`, args: []string{"convert", "-o", "out file.svg"}},
+		{command: `sh -c 'a "b" c'`, args: []string{"sh", "-c", `a "b" c`}},
+		{command: `tool "say \"hi\"" a\ b ''`, args: []string{"tool", `say "hi"`, "a b", ""}},
+		{command: " \t "},
+		{command: `tool "open`, err: true},
+		{command: `tool a\`, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			args, err := Diagram{Command: tt.command}.Args()
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %q, want %q", args, tt.args)
+			}
+		})
+	}
+}
+
+// taskIDs renders src with a fresh task list renderer and returns the task IDs by task text
+func taskIDs(t *testing.T, src string) map[string][]string {
+	md := goldmark.New(
+		goldmark.WithExtensions(extension.TaskList),
+		goldmark.WithRendererOptions(renderer.WithNodeRenderers(util.Prioritized(NewConfluenceTaskListHTMLRender(), 100))),
+	)
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(src), &buf); err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string][]string)
+	for _, match := range regexp.MustCompile(`<ac:task-id>(\d+)</ac:task-id>\n<ac:task-status>\w+</ac:task-status>\n<ac:task-body>([^<]*)</ac:task-body>`).FindAllStringSubmatch(buf.String(), -1) {
+		ids[match[2]] = append(ids[match[2]], match[1])
+	}
+	return ids
+}
+
+func TestTaskID(t *testing.T) {
+	const src = "- [ ] write\n- [x] review\n- [ ] ship\n"
+	ids := taskIDs(t, src)
+	if len(ids) != 3 {
+		t.Fatalf("task IDs = %v, want three tasks", ids)
+	}
+
+	tests := []struct {
+		name    string
+		src     string
+		same    []string
+		changed []string
+	}{
+		{
+			name: "rendered again",
+			src:  src,
+			same: []string{"write", "review", "ship"},
+		},
+		{
+			name: "reordered",
+			src:  "- [ ] ship\n- [ ] write\n- [x] review\n",
+			same: []string{"write", "review", "ship"},
+		},
+		{
+			name: "task added",
+			src:  "- [ ] plan\n" + src,
+			same: []string{"write", "review", "ship"},
+		},
+		{
+			name:    "task checked",
+			src:     "- [x] write\n- [x] review\n- [ ] ship\n",
+			same:    []string{"review", "ship"},
+			changed: []string{"write"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := taskIDs(t, tt.src)
+			for _, task := range tt.same {
+				if !reflect.DeepEqual(got[task], ids[task]) {
+					t.Errorf("ID of %q = %v, want %v", task, got[task], ids[task])
+				}
+			}
+			for _, task := range tt.changed {
+				if reflect.DeepEqual(got[task], ids[task]) {
+					t.Errorf("ID of %q = %v, want a new ID", task, got[task])
+				}
+			}
+		})
+	}
+
+	if dup := taskIDs(t, "- [ ] same\n- [ ] same\n")["same"]; len(dup) != 2 || dup[0] == dup[1] {
+		t.Errorf("IDs of identical tasks = %v, want two distinct IDs", dup)
+	}
+}
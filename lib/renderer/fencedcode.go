@@ -1,6 +1,7 @@
 package renderer
 
 import (
+	"bytes"
 	"strings"
 
 	"github.com/yuin/goldmark/ast"
@@ -13,12 +14,21 @@ import (
 // renders FencedCodeBlock nodes.
 type ConfluenceFencedCodeBlockHTMLRender struct {
 	html.Config
+	Diagrams DiagramConfig
+	// Flavor is the Confluence the code macros are rendered for
+	Flavor string
+	// Images holds the converted diagrams for later upload
+	Images   []string
+	filePath string
 }
 
 // NewConfluenceFencedCodeBlockHTMLRender returns a new ConfluenceFencedCodeBlockHTMLRender.
-func NewConfluenceFencedCodeBlockHTMLRender(opts ...html.Option) renderer.NodeRenderer {
+// Fences of the languages configured in diagrams are rendered as diagrams.
+func NewConfluenceFencedCodeBlockHTMLRender(filePath string, diagrams DiagramConfig, opts ...html.Option) *ConfluenceFencedCodeBlockHTMLRender {
 	r := &ConfluenceFencedCodeBlockHTMLRender{
-		Config: html.NewConfig(),
+		Config:   html.NewConfig(),
+		Diagrams: diagrams,
+		filePath: filePath,
 	}
 	for _, opt := range opts {
 		opt.SetHTMLOption(&r.Config)
@@ -40,6 +50,17 @@ func (r *ConfluenceFencedCodeBlockHTMLRender) renderConfluenceFencedCode(w util.
 	if language != nil {
 		langString = string(language)
 	}
+	if d, ok := r.Diagrams.Languages[langString]; ok && (d.Macro != "" || d.Command != "") {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		var src bytes.Buffer
+		for i := 0; i < n.Lines().Len(); i++ {
+			line := n.Lines().At(i)
+			src.Write(line.Value(source))
+		}
+		return ast.WalkSkipChildren, r.renderDiagram(w, langString, d, src.Bytes())
+	}
 	if entering {
 		// If it is a macro create the macro
 		if langString == "CONFLUENCE-MACRO" {
@@ -51,7 +72,9 @@ func (r *ConfluenceFencedCodeBlockHTMLRender) renderConfluenceFencedCode(w util.
 			s = s + `<ac:parameter ac:name="linenumbers">true</ac:parameter>`
 
 			if language != nil {
-				s = s + `<ac:parameter ac:name="language">` + langString + `</ac:parameter>`
+				if lang, ok := codeLanguage(r.Flavor, langString); ok {
+					s = s + `<ac:parameter ac:name="language">` + lang + `</ac:parameter>`
+				}
 			}
 
 			s = s + `<ac:plain-text-body><![CDATA[ `
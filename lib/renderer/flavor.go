@@ -0,0 +1,97 @@
+package renderer
+
+import "strings"
+
+// Flavors of Confluence the storage format is rendered for
+const (
+	// FlavorCloud is Confluence Cloud
+	FlavorCloud = "cloud"
+	// FlavorDataCenter is Confluence Data Center and Server
+	FlavorDataCenter = "datacenter"
+)
+
+// dataCenterLanguages maps fence languages to the languages of the code
+// macro of Confluence Data Center, which shows an error for any other.
+// Confluence Cloud highlights many more languages and takes them as they are.
+var dataCenterLanguages = map[string]string{
+	"actionscript":  "actionscript3",
+	"actionscript3": "actionscript3",
+	"as3":           "actionscript3",
+	"applescript":   "applescript",
+	"bash":          "bash",
+	"console":       "bash",
+	"sh":            "bash",
+	"shell":         "bash",
+	"zsh":           "bash",
+	"c#":            "c#",
+	"cs":            "c#",
+	"csharp":        "c#",
+	"c":             "cpp",
+	"c++":           "cpp",
+	"cc":            "cpp",
+	"cpp":           "cpp",
+	"h":             "cpp",
+	"hpp":           "cpp",
+	"cfm":           "coldfusion",
+	"coldfusion":    "coldfusion",
+	"css":           "css",
+	"delphi":        "delphi",
+	"pascal":        "delphi",
+	"diff":          "diff",
+	"patch":         "diff",
+	"erl":           "erl",
+	"erlang":        "erl",
+	"gradle":        "groovy",
+	"groovy":        "groovy",
+	"java":          "java",
+	"javafx":        "javafx",
+	"javascript":    "js",
+	"js":            "js",
+	"json":          "js",
+	"jsx":           "js",
+	"ts":            "js",
+	"tsx":           "js",
+	"typescript":    "js",
+	"none":          "none",
+	"plain":         "none",
+	"plaintext":     "none",
+	"text":          "none",
+	"txt":           "none",
+	"perl":          "perl",
+	"pl":            "perl",
+	"php":           "php",
+	"powershell":    "powershell",
+	"ps":            "powershell",
+	"ps1":           "powershell",
+	"pwsh":          "powershell",
+	"py":            "py",
+	"python":        "py",
+	"python3":       "py",
+	"rb":            "ruby",
+	"ruby":          "ruby",
+	"sass":          "sass",
+	"scss":          "sass",
+	"scala":         "scala",
+	"mysql":         "sql",
+	"plsql":         "sql",
+	"postgresql":    "sql",
+	"sql":           "sql",
+	"vb":            "vb",
+	"vbnet":         "vb",
+	"html":          "xml",
+	"svg":           "xml",
+	"xhtml":         "xml",
+	"xml":           "xml",
+	"yaml":          "yml",
+	"yml":           "yml",
+}
+
+// codeLanguage returns the language parameter of the code macro for the
+// fence language lang, or false if the flavor has no such language
+func codeLanguage(flavor, lang string) (string, bool) {
+	if flavor != FlavorDataCenter {
+		return lang, true
+	}
+	language, ok := dataCenterLanguages[strings.ToLower(lang)]
+	return language, ok
+}
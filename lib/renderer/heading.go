@@ -0,0 +1,51 @@
+package renderer
+
+import (
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// ConfluenceHeadingHTMLRender is a renderer.NodeRenderer implementation that
+// renders headings with an anchor macro named after the heading ID, as
+// Confluence drops id attributes and names its own anchors differently.
+type ConfluenceHeadingHTMLRender struct {
+	html.Config
+}
+
+// NewConfluenceHeadingHTMLRender returns a new ConfluenceHeadingHTMLRender.
+func NewConfluenceHeadingHTMLRender(opts ...html.Option) renderer.NodeRenderer {
+	r := &ConfluenceHeadingHTMLRender{
+		Config: html.NewConfig(),
+	}
+	for _, opt := range opts {
+		opt.SetHTMLOption(&r.Config)
+	}
+	return r
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (r *ConfluenceHeadingHTMLRender) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindHeading, r.renderHeading)
+}
+
+func (r *ConfluenceHeadingHTMLRender) renderHeading(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.Heading)
+	if !entering {
+		_, _ = w.WriteString("</h")
+		_ = w.WriteByte("0123456"[n.Level])
+		_, _ = w.WriteString(">\n")
+		return ast.WalkContinue, nil
+	}
+
+	_, _ = w.WriteString("<h")
+	_ = w.WriteByte("0123456"[n.Level])
+	_ = w.WriteByte('>')
+	if id, ok := n.AttributeString("id"); ok {
+		_, _ = w.WriteString(`<ac:structured-macro ac:name="anchor" ac:schema-version="1"><ac:parameter ac:name="">`)
+		_, _ = w.Write(util.EscapeHTML(id.([]byte)))
+		_, _ = w.WriteString(`</ac:parameter></ac:structured-macro>`)
+	}
+	return ast.WalkContinue, nil
+}
@@ -0,0 +1,159 @@
+package renderer
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// PageLink identifies the Confluence page a markdown file is published to
+type PageLink struct {
+	Title string
+	Space string
+}
+
+// PageResolver returns the page the markdown file at the given absolute path
+// is published to, and false if the file is not part of the sync set
+type PageResolver func(path string) (PageLink, bool)
+
+// ConfluenceLinkHTMLRender is a renderer.NodeRenderer implementation that
+// renders links to other markdown files as Confluence page links.
+type ConfluenceLinkHTMLRender struct {
+	html.Config
+	Warnings []string
+	filePath string
+	resolve  PageResolver
+}
+
+// NewConfluenceLinkHTMLRender returns a new ConfluenceLinkHTMLRender.
+func NewConfluenceLinkHTMLRender(filePath string, resolve PageResolver, opts ...html.Option) *ConfluenceLinkHTMLRender {
+	r := &ConfluenceLinkHTMLRender{
+		Config:   html.NewConfig(),
+		filePath: filePath,
+		resolve:  resolve,
+	}
+
+	for _, opt := range opts {
+		opt.SetHTMLOption(&r.Config)
+	}
+
+	return r
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (r *ConfluenceLinkHTMLRender) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindLink, r.renderConfluenceLink)
+}
+
+func (r *ConfluenceLinkHTMLRender) renderConfluenceLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.Link)
+
+	// Links within the page point to the anchor macros rendered for headings
+	if anchor, ok := pageAnchor(string(n.Destination)); ok {
+		if entering {
+			_, _ = w.WriteString(`<ac:link ac:anchor="`)
+			_, _ = w.Write(util.EscapeHTML([]byte(anchor)))
+			_, _ = w.WriteString(`"><ac:link-body>`)
+		} else {
+			_, _ = w.WriteString(`</ac:link-body></ac:link>`)
+		}
+		return ast.WalkContinue, nil
+	}
+
+	target, anchor, isMarkdown := markdownTarget(r.filePath, string(n.Destination))
+	var page PageLink
+	var ok bool
+	if isMarkdown && r.resolve != nil {
+		page, ok = r.resolve(target)
+	}
+
+	if !ok {
+		if entering && isMarkdown {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("%s links to %s which is not part of the sync set", r.filePath, n.Destination))
+		}
+		return r.renderLink(w, n, entering)
+	}
+
+	if entering {
+		_, _ = w.WriteString(`<ac:link`)
+		if anchor != "" {
+			_, _ = w.WriteString(` ac:anchor="`)
+			_, _ = w.Write(util.EscapeHTML([]byte(anchor)))
+			_ = w.WriteByte('"')
+		}
+		_, _ = w.WriteString(`><ri:page ri:content-title="`)
+		_, _ = w.Write(util.EscapeHTML([]byte(page.Title)))
+		_ = w.WriteByte('"')
+		if page.Space != "" {
+			_, _ = w.WriteString(` ri:space-key="`)
+			_, _ = w.Write(util.EscapeHTML([]byte(page.Space)))
+			_ = w.WriteByte('"')
+		}
+		_, _ = w.WriteString(`/><ac:link-body>`)
+	} else {
+		_, _ = w.WriteString(`</ac:link-body></ac:link>`)
+	}
+	return ast.WalkContinue, nil
+}
+
+// renderLink renders n as a regular XHTML link
+func (r *ConfluenceLinkHTMLRender) renderLink(w util.BufWriter, n *ast.Link, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString("<a href=\"")
+		if r.Unsafe || !html.IsDangerousURL(n.Destination) {
+			_, _ = w.Write(util.EscapeHTML(util.URLEscape(n.Destination, true)))
+		}
+		_ = w.WriteByte('"')
+		if n.Title != nil {
+			_, _ = w.WriteString(` title="`)
+			r.Writer.Write(w, n.Title)
+			_ = w.WriteByte('"')
+		}
+		if n.Attributes() != nil {
+			html.RenderAttributes(w, n, html.LinkAttributeFilter)
+		}
+		_ = w.WriteByte('>')
+	} else {
+		_, _ = w.WriteString("</a>")
+	}
+	return ast.WalkContinue, nil
+}
+
+// markdownTarget splits a link destination into the absolute path of the
+// markdown file it points to and its anchor. isMarkdown is false for
+// external URLs and links to anything but a .md file.
+func markdownTarget(filePath, destination string) (target, anchor string, isMarkdown bool) {
+	u, err := url.Parse(destination)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "", "", false
+	}
+	if !strings.HasSuffix(strings.ToLower(u.Path), ".md") {
+		return "", "", false
+	}
+
+	target = filepath.FromSlash(u.Path)
+	if !filepath.IsAbs(target) {
+		absFilePath, _ := filepath.Abs(filePath)
+		target = filepath.Join(filepath.Dir(absFilePath), target)
+	}
+	return filepath.Clean(target), u.Fragment, true
+}
+
+// pageAnchor returns the decoded fragment of a destination that only
+// consists of a fragment, e.g. #install-steps
+func pageAnchor(destination string) (string, bool) {
+	if len(destination) < 2 || destination[0] != '#' {
+		return "", false
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", false
+	}
+	return u.Fragment, true
+}
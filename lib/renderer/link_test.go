@@ -0,0 +1,134 @@
+package renderer
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+func TestMarkdownTarget(t *testing.T) {
+	tests := []struct {
+		destination string
+		target      string
+		anchor      string
+		isMarkdown  bool
+	}{
+		{destination: "other.md", target: "/docs/guide/other.md", isMarkdown: true},
+		{destination: "./sub/page.md", target: "/docs/guide/sub/page.md", isMarkdown: true},
+		{destination: "../api/ref.md#usage", target: "/docs/api/ref.md", anchor: "usage", isMarkdown: true},
+		{destination: "../../../outside.md", target: "/outside.md", isMarkdown: true},
+		{destination: "/abs/page.md", target: "/abs/page.md", isMarkdown: true},
+		{destination: "my%20page.md#%E5%AE%89%E8%A3%85", target: "/docs/guide/my page.md", anchor: "安装", isMarkdown: true},
+		{destination: "README.MD", target: "/docs/guide/README.MD", isMarkdown: true},
+		{destination: "https://example.com/page.md"},
+		{destination: "//example.com/page.md"},
+		{destination: "image.png"},
+		{destination: "#section"},
+		{destination: "%zz.md"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.destination, func(t *testing.T) {
+			target, anchor, isMarkdown := markdownTarget("/docs/guide/page.md", tt.destination)
+			if target != tt.target || anchor != tt.anchor || isMarkdown != tt.isMarkdown {
+				t.Errorf("markdownTarget(%q) = %q, %q, %v, want %q, %q, %v", tt.destination, target, anchor, isMarkdown, tt.target, tt.anchor, tt.isMarkdown)
+			}
+		})
+	}
+}
+
+func TestPageAnchor(t *testing.T) {
+	tests := []struct {
+		destination string
+		anchor      string
+		ok          bool
+	}{
+		{destination: "#install-steps", anchor: "install-steps", ok: true},
+		{destination: "#%E5%AE%89%E8%A3%85", anchor: "安装", ok: true},
+		{destination: "#"},
+		{destination: ""},
+		{destination: "page.md#install"},
+		{destination: "#%zz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.destination, func(t *testing.T) {
+			anchor, ok := pageAnchor(tt.destination)
+			if anchor != tt.anchor || ok != tt.ok {
+				t.Errorf("pageAnchor(%q) = %q, %v, want %q, %v", tt.destination, anchor, ok, tt.anchor, tt.ok)
+			}
+		})
+	}
+}
+
+func TestConfluenceLink(t *testing.T) {
+	pages := map[string]PageLink{
+		"/docs/guide/other.md": {Title: "Other Page"},
+		"/docs/api/ref.md":     {Title: "API & Reference", Space: "API"},
+	}
+	resolve := func(p string) (PageLink, bool) {
+		page, ok := pages[p]
+		return page, ok
+	}
+
+	tests := []struct {
+		name     string
+		src      string
+		html     string
+		warnings []string
+	}{
+		{
+			name: "relative link",
+			src:  "[other](other.md)",
+			html: `<p><ac:link><ri:page ri:content-title="Other Page"/><ac:link-body>other</ac:link-body></ac:link></p>` + "\n",
+		},
+		{
+			name: "anchor in another space",
+			src:  "[ref](../api/ref.md#usage)",
+			html: `<p><ac:link ac:anchor="usage"><ri:page ri:content-title="API &amp; Reference" ri:space-key="API"/><ac:link-body>ref</ac:link-body></ac:link></p>` + "\n",
+		},
+		{
+			name: "anchor within the page",
+			src:  "[install](#install-steps)",
+			html: `<p><ac:link ac:anchor="install-steps"><ac:link-body>install</ac:link-body></ac:link></p>` + "\n",
+		},
+		{
+			name:     "outside the sync directory",
+			src:      "[outside](../../outside.md)",
+			html:     `<p><a href="../../outside.md">outside</a></p>` + "\n",
+			warnings: []string{"/docs/guide/page.md links to ../../outside.md which is not part of the sync set"},
+		},
+		{
+			name:     "file that does not exist",
+			src:      "[missing](missing.md)",
+			html:     `<p><a href="missing.md">missing</a></p>` + "\n",
+			warnings: []string{"/docs/guide/page.md links to missing.md which is not part of the sync set"},
+		},
+		{
+			name: "external link",
+			src:  `[site](https://example.com/page.md "Site")`,
+			html: `<p><a href="https://example.com/page.md" title="Site">site</a></p>` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link := NewConfluenceLinkHTMLRender("/docs/guide/page.md", resolve)
+			md := goldmark.New(goldmark.WithRendererOptions(renderer.WithNodeRenderers(util.Prioritized(link, 100))))
+			var buf bytes.Buffer
+			if err := md.Convert([]byte(tt.src), &buf); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.html {
+				t.Errorf("html = %q, want %q", buf.String(), tt.html)
+			}
+			if !reflect.DeepEqual(link.Warnings, tt.warnings) {
+				t.Errorf("warnings = %q, want %q", link.Warnings, tt.warnings)
+			}
+		})
+	}
+}
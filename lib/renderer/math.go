@@ -0,0 +1,99 @@
+package renderer
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+
+	cast "markdownToConfluence/lib/extension/ast"
+)
+
+// Math macros formulas can be rendered with
+const (
+	// MathMacro renders formulas with the mathinline and mathblock macros
+	MathMacro = "math"
+	// LatexMacro renders formulas with the latex macro
+	LatexMacro = "latex"
+	// CodeMacro renders formulas as code, for Confluence without a math app
+	// such as Data Center, where the math macros are not available by default
+	CodeMacro = "code"
+)
+
+// ConfluenceMathHTMLRender is a renderer.NodeRenderer implementation that
+// renders MathBlock and InlineMath nodes as Confluence math macros.
+type ConfluenceMathHTMLRender struct {
+	html.Config
+	Macro string
+}
+
+// NewConfluenceMathHTMLRender returns a new ConfluenceMathHTMLRender that
+// renders formulas with macro, MathMacro, LatexMacro or CodeMacro.
+func NewConfluenceMathHTMLRender(macro string, opts ...html.Option) renderer.NodeRenderer {
+	r := &ConfluenceMathHTMLRender{
+		Config: html.NewConfig(),
+		Macro:  macro,
+	}
+	for _, opt := range opts {
+		opt.SetHTMLOption(&r.Config)
+	}
+	return r
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (r *ConfluenceMathHTMLRender) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(cast.KindMathBlock, r.renderMathBlock)
+	reg.Register(cast.KindInlineMath, r.renderInlineMath)
+}
+
+func (r *ConfluenceMathHTMLRender) renderMathBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	var formula bytes.Buffer
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		formula.Write(line.Value(source))
+	}
+	s := strings.TrimSpace(formula.String())
+
+	switch r.Macro {
+	case LatexMacro:
+		_, _ = w.WriteString(`<ac:structured-macro ac:name="latex" ac:schema-version="1"><ac:plain-text-body><![CDATA[$$` + cdata(s) + `$$]]></ac:plain-text-body></ac:structured-macro>` + "\n")
+	case CodeMacro:
+		_, _ = w.WriteString(`<ac:structured-macro ac:name="code" ac:schema-version="1"><ac:parameter ac:name="language">none</ac:parameter><ac:plain-text-body><![CDATA[` + cdata(s) + `]]></ac:plain-text-body></ac:structured-macro>` + "\n")
+	default:
+		_, _ = w.WriteString(`<ac:structured-macro ac:name="mathblock" ac:schema-version="1"><ac:plain-text-body><![CDATA[` + cdata(s) + `]]></ac:plain-text-body></ac:structured-macro>` + "\n")
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *ConfluenceMathHTMLRender) renderInlineMath(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*cast.InlineMath)
+
+	switch r.Macro {
+	case LatexMacro:
+		_, _ = w.WriteString(`<ac:structured-macro ac:name="latex" ac:schema-version="1"><ac:plain-text-body><![CDATA[$` + cdata(string(n.Formula)) + `$]]></ac:plain-text-body></ac:structured-macro>`)
+	case CodeMacro:
+		_, _ = w.WriteString(`<code>`)
+		_, _ = w.Write(util.EscapeHTML(n.Formula))
+		_, _ = w.WriteString(`</code>`)
+	default:
+		_, _ = w.WriteString(`<ac:structured-macro ac:name="mathinline" ac:schema-version="1"><ac:parameter ac:name="body">`)
+		_, _ = w.Write(util.EscapeHTML(n.Formula))
+		_, _ = w.WriteString(`</ac:parameter></ac:structured-macro>`)
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+// cdata escapes the end of a CDATA section in s
+func cdata(s string) string {
+	return strings.Replace(s, "]]>", "]]]]><![CDATA[>", -1)
+}
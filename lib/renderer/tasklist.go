@@ -0,0 +1,169 @@
+package renderer
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// ConfluenceTaskListHTMLRender is a renderer.NodeRenderer implementation that
+// renders GFM task lists as Confluence task lists. Lists that mix tasks and
+// regular items are rendered as regular lists.
+type ConfluenceTaskListHTMLRender struct {
+	html.Config
+	taskIDs map[uint32]bool
+}
+
+// NewConfluenceTaskListHTMLRender returns a new ConfluenceTaskListHTMLRender.
+func NewConfluenceTaskListHTMLRender(opts ...html.Option) *ConfluenceTaskListHTMLRender {
+	r := &ConfluenceTaskListHTMLRender{
+		Config:  html.NewConfig(),
+		taskIDs: make(map[uint32]bool),
+	}
+	for _, opt := range opts {
+		opt.SetHTMLOption(&r.Config)
+	}
+	return r
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (r *ConfluenceTaskListHTMLRender) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindList, r.renderList)
+	reg.Register(ast.KindListItem, r.renderListItem)
+	reg.Register(east.KindTaskCheckBox, r.renderTaskCheckBox)
+}
+
+// taskCheckBox returns the check box of a task list item, or nil for regular items
+func taskCheckBox(item ast.Node) *east.TaskCheckBox {
+	if fc := item.FirstChild(); fc != nil {
+		if box, ok := fc.FirstChild().(*east.TaskCheckBox); ok {
+			return box
+		}
+	}
+	return nil
+}
+
+// isTaskList reports whether every item of the list is a task
+func isTaskList(list ast.Node) bool {
+	if !list.HasChildren() {
+		return false
+	}
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		if taskCheckBox(item) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *ConfluenceTaskListHTMLRender) renderList(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.List)
+	if isTaskList(n) {
+		if entering {
+			_, _ = w.WriteString("<ac:task-list>\n")
+		} else {
+			_, _ = w.WriteString("</ac:task-list>\n")
+		}
+		return ast.WalkContinue, nil
+	}
+
+	tag := "ul"
+	if n.IsOrdered() {
+		tag = "ol"
+	}
+	if entering {
+		_ = w.WriteByte('<')
+		_, _ = w.WriteString(tag)
+		if n.IsOrdered() && n.Start != 1 {
+			fmt.Fprintf(w, " start=\"%d\"", n.Start)
+		}
+		if n.Attributes() != nil {
+			html.RenderAttributes(w, n, html.ListAttributeFilter)
+		}
+		_, _ = w.WriteString(">\n")
+	} else {
+		_, _ = w.WriteString("</")
+		_, _ = w.WriteString(tag)
+		_, _ = w.WriteString(">\n")
+	}
+	return ast.WalkContinue, nil
+}
+
+func (r *ConfluenceTaskListHTMLRender) renderListItem(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if isTaskList(n.Parent()) {
+		if entering {
+			box := taskCheckBox(n)
+			status := "incomplete"
+			if box.IsChecked {
+				status = "complete"
+			}
+			fmt.Fprintf(w, "<ac:task>\n<ac:task-id>%d</ac:task-id>\n<ac:task-status>%s</ac:task-status>\n<ac:task-body>", r.taskID(n, source), status)
+		} else {
+			_, _ = w.WriteString("</ac:task-body>\n</ac:task>\n")
+		}
+		return ast.WalkContinue, nil
+	}
+
+	if entering {
+		if n.Attributes() != nil {
+			_, _ = w.WriteString("<li")
+			html.RenderAttributes(w, n, html.ListItemAttributeFilter)
+			_ = w.WriteByte('>')
+		} else {
+			_, _ = w.WriteString("<li>")
+		}
+		fc := n.FirstChild()
+		if fc != nil {
+			if _, ok := fc.(*ast.TextBlock); !ok {
+				_ = w.WriteByte('\n')
+			}
+		}
+	} else {
+		_, _ = w.WriteString("</li>\n")
+	}
+	return ast.WalkContinue, nil
+}
+
+// renderTaskCheckBox renders nothing for tasks, and a check box character
+// for task items in mixed lists, as Confluence drops input elements
+func (r *ConfluenceTaskListHTMLRender) renderTaskCheckBox(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*east.TaskCheckBox)
+	if item := n.Parent().Parent(); item != nil && isTaskList(item.Parent()) {
+		return ast.WalkContinue, nil
+	}
+	if n.IsChecked {
+		_, _ = w.WriteString("☑ ")
+	} else {
+		_, _ = w.WriteString("☐ ")
+	}
+	return ast.WalkContinue, nil
+}
+
+// taskID derives the ID of a task from its text and check state. A task
+// keeps its ID, and the state it was given in Confluence, until either
+// changes in the markdown.
+func (r *ConfluenceTaskListHTMLRender) taskID(item ast.Node, source []byte) uint32 {
+	h := fnv.New32a()
+	if taskCheckBox(item).IsChecked {
+		_, _ = h.Write([]byte("[x]"))
+	} else {
+		_, _ = h.Write([]byte("[ ]"))
+	}
+	_, _ = h.Write(item.FirstChild().Text(source))
+
+	// Task IDs are positive numbers that must be unique within the page
+	id := h.Sum32()%1000000000 + 1
+	for r.taskIDs[id] {
+		id = id%1000000000 + 1
+	}
+	r.taskIDs[id] = true
+	return id
+}
@@ -0,0 +1,641 @@
+// Package storage converts Confluence storage format back into markdown
+package storage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// LinkResolver returns the link destination for the page with the given
+// title in the given space. Space is empty for pages in the current space.
+type LinkResolver func(title, space string) string
+
+// Converter converts storage format XHTML into markdown
+type Converter struct {
+	Resolve  LinkResolver
+	Warnings []string
+
+	// Attachments is the directory, relative to the markdown file, that
+	// images and links refer to attachments in
+	Attachments string
+
+	// Toc is set when the page contains a table of contents macro without
+	// other parameters than TocParams
+	Toc       bool
+	TocParams map[string]string
+}
+
+// tocParams are the table of contents parameters kept in the front matter
+var tocParams = map[string]bool{"minLevel": true, "maxLevel": true, "style": true}
+
+// alertTypes maps Confluence panel macros to GitHub alert types
+var alertTypes = map[string]string{
+	"info":    "NOTE",
+	"tip":     "TIP",
+	"note":    "IMPORTANT",
+	"warning": "WARNING",
+}
+
+// node is an element or a text node of the parsed storage format
+type node struct {
+	name     string
+	attrs    map[string]string
+	text     string
+	children []*node
+}
+
+// attr returns the value of the attribute with the given name, e.g. "ri:content-title"
+func (n *node) attr(name string) string {
+	return n.attrs[name]
+}
+
+// child returns the first child element with the given name
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// textContent returns the text of n and all its descendants
+func (n *node) textContent() string {
+	if n.name == "" {
+		return n.text
+	}
+	var sb strings.Builder
+	for _, c := range n.children {
+		sb.WriteString(c.textContent())
+	}
+	return sb.String()
+}
+
+// autoClose lists the void HTML elements. xml.HTMLAutoClose can not be used
+// as it includes "link", which would also match ac:link.
+var autoClose = []string{"br", "hr", "img", "input", "col", "area", "wbr"}
+
+// parse reads storage format into a tree. Storage format uses namespace
+// prefixes without declaring them and HTML entities, so the decoder runs in
+// non-strict mode.
+func parse(s string) (*node, error) {
+	d := xml.NewDecoder(strings.NewReader("<root>" + s + "</root>"))
+	d.Strict = false
+	d.AutoClose = autoClose
+	d.Entity = xml.HTMLEntity
+
+	document := &node{}
+	stack := []*node{document}
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			if len(document.children) == 0 {
+				return document, nil
+			}
+			return document.children[0], nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parent := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &node{name: qualifiedName(t.Name), attrs: make(map[string]string)}
+			for _, a := range t.Attr {
+				n.attrs[qualifiedName(a.Name)] = a.Value
+			}
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.children = append(parent.children, &node{text: string(t)})
+		}
+	}
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return strings.ToLower(name.Local)
+	}
+	return name.Space + ":" + name.Local
+}
+
+// Convert returns the markdown for the storage format body s
+func (c *Converter) Convert(s string) (string, error) {
+	root, err := parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid storage format: %s", err)
+	}
+	return strings.TrimSpace(c.blocks(root.children)) + "\n", nil
+}
+
+func (c *Converter) warn(format string, args ...interface{}) {
+	c.Warnings = append(c.Warnings, fmt.Sprintf(format, args...))
+}
+
+// blocks renders a sequence of block level nodes, wrapping runs of inline
+// nodes into paragraphs
+func (c *Converter) blocks(nodes []*node) string {
+	var parts []string
+	var inline []*node
+	flush := func() {
+		if text := c.paragraph(inline); text != "" {
+			parts = append(parts, text)
+		}
+		inline = nil
+	}
+
+	for _, n := range nodes {
+		block := c.block(n)
+		if block == nil {
+			inline = append(inline, n)
+			continue
+		}
+		flush()
+		if text := strings.TrimRight(*block, "\n"); strings.TrimSpace(text) != "" {
+			parts = append(parts, text)
+		}
+	}
+	flush()
+	return strings.Join(parts, "\n\n")
+}
+
+var headings = regexp.MustCompile(`^h([1-6])$`)
+
+// block renders n if it is a block level node, and returns nil otherwise
+func (c *Converter) block(n *node) *string {
+	var s string
+	switch {
+	case n.name == "p":
+		s = c.paragraph(n.children)
+	case headings.MatchString(n.name):
+		level, _ := strconv.Atoi(n.name[1:])
+		s = strings.Repeat("#", level) + " " + strings.TrimSpace(c.inlines(n.children))
+	case n.name == "ul" || n.name == "ol":
+		s = c.list(n)
+	case n.name == "ac:task-list":
+		s = c.taskList(n)
+	case n.name == "pre":
+		s = fence(n.textContent(), "")
+	case n.name == "blockquote":
+		s = quote(c.blocks(n.children))
+	case n.name == "hr":
+		s = "---"
+	case n.name == "table":
+		s = c.table(n)
+	case n.name == "ac:structured-macro" || n.name == "ac:macro":
+		s = c.macro(n)
+	case n.name == "div" || n.name == "section" || n.name == "ac:layout" || n.name == "ac:layout-section" || n.name == "ac:layout-cell":
+		s = c.blocks(n.children)
+	default:
+		return nil
+	}
+	return &s
+}
+
+// inlines renders a sequence of inline nodes
+func (c *Converter) inlines(nodes []*node) string {
+	var sb strings.Builder
+	for _, n := range nodes {
+		sb.WriteString(c.inline(n))
+	}
+	return sb.String()
+}
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+func (c *Converter) inline(n *node) string {
+	switch n.name {
+	case "":
+		return escape(whitespace.ReplaceAllString(n.text, " "))
+	case "strong", "b":
+		return wrap("**", c.inlines(n.children))
+	case "em", "i":
+		return wrap("*", c.inlines(n.children))
+	case "del", "s":
+		return wrap("~~", c.inlines(n.children))
+	case "code":
+		return code(n.textContent())
+	case "br":
+		return "\\\n"
+	case "a":
+		return "[" + c.inlines(n.children) + "](" + destination(n.attr("href")) + ")"
+	case "img":
+		return "![" + escape(n.attr("alt")) + "](" + destination(n.attr("src")) + ")"
+	case "ac:image":
+		return c.image(n)
+	case "ac:link":
+		return c.link(n)
+	case "time":
+		return n.attr("datetime")
+	case "input":
+		// Task list items rendered by goldmark
+		if n.attr("type") == "checkbox" {
+			if _, ok := n.attrs["checked"]; ok {
+				return "[x]"
+			}
+			return "[ ]"
+		}
+		return ""
+	case "ac:emoticon", "ac:placeholder":
+		return ""
+	case "ac:structured-macro", "ac:macro":
+		if formula, ok := mathFormula(n); ok {
+			return "$" + formula + "$"
+		}
+		if n.attr("ac:name") == "anchor" {
+			// Every heading gets an anchor on upload
+			return ""
+		}
+		c.warn("inline macro %s was dropped", n.attr("ac:name"))
+		return ""
+	}
+	if block := c.block(n); block != nil {
+		// Block content inside inline content, e.g. a paragraph in a table cell
+		return " " + strings.Replace(strings.TrimSpace(*block), "\n\n", " ", -1) + " "
+	}
+	return c.inlines(n.children)
+}
+
+// wrap puts the delimiter around s, keeping surrounding whitespace outside
+func wrap(delimiter, s string) string {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return s
+	}
+	start := s[:strings.Index(s, trimmed)]
+	end := s[len(start)+len(trimmed):]
+	return start + delimiter + trimmed + delimiter + end
+}
+
+// escape backslash escapes the characters of s that would otherwise be read
+// as markdown. Underscores within words do not start emphasis and are kept.
+func escape(s string) string {
+	runes := []rune(s)
+	var sb strings.Builder
+	for i, r := range runes {
+		switch r {
+		case '\\', '`', '*', '[', ']', '<':
+			sb.WriteByte('\\')
+		case '_':
+			if i == 0 || i == len(runes)-1 || !isWord(runes[i-1]) || !isWord(runes[i+1]) {
+				sb.WriteByte('\\')
+			}
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// blockStart matches text at the start of a paragraph that would be read as another block
+var blockStart = regexp.MustCompile(`^(#{1,6}(\s|$)|[-+>]\s|\d+[.)]\s|={3,}|-{3,})`)
+
+// paragraph renders inline nodes as a paragraph
+func (c *Converter) paragraph(nodes []*node) string {
+	text := strings.Replace(strings.TrimSpace(c.inlines(nodes)), "\\\n ", "\\\n", -1)
+	if blockStart.MatchString(text) {
+		text = "\\" + text
+	}
+	return text
+}
+
+// code renders an inline code span, using a longer delimiter when s contains backticks
+func code(s string) string {
+	delimiter := "`"
+	for strings.Contains(s, delimiter) {
+		delimiter += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return delimiter + s + delimiter
+}
+
+// destination formats a link destination, using the pointy bracket form when it contains spaces
+func destination(s string) string {
+	if strings.ContainsAny(s, " ()") {
+		return "<" + s + ">"
+	}
+	return s
+}
+
+// fence renders a fenced code block
+func fence(s, language string) string {
+	delimiter := "```"
+	for strings.Contains(s, delimiter) {
+		delimiter += "`"
+	}
+	return delimiter + language + "\n" + strings.TrimRight(s, "\n") + "\n" + delimiter
+}
+
+// quote prefixes every line of s with "> "
+func quote(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = ">"
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indent indents all lines of s but the first by n spaces
+func indent(s string, n int) string {
+	lines := strings.Split(s, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = strings.Repeat(" ", n) + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *Converter) list(n *node) string {
+	var items []string
+	number := 1
+	if start, err := strconv.Atoi(n.attr("start")); err == nil {
+		number = start
+	}
+	for _, li := range n.children {
+		if li.name != "li" {
+			continue
+		}
+		marker := "- "
+		if n.name == "ol" {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		items = append(items, marker+indent(c.listItem(li.children), len(marker)))
+	}
+	return strings.Join(items, "\n")
+}
+
+// listItem renders the content of a list item. Items that only hold text
+// and nested lists are kept tight.
+func (c *Converter) listItem(nodes []*node) string {
+	tight := true
+	for _, n := range nodes {
+		if b := c.block(n); b != nil && n.name != "ul" && n.name != "ol" && n.name != "ac:task-list" {
+			tight = false
+		}
+	}
+	if !tight {
+		return c.blocks(nodes)
+	}
+
+	var parts []string
+	var inline []*node
+	for _, n := range nodes {
+		if n.name == "ul" || n.name == "ol" || n.name == "ac:task-list" {
+			parts = append(parts, strings.TrimSpace(c.inlines(inline)), *c.block(n))
+			inline = nil
+			continue
+		}
+		inline = append(inline, n)
+	}
+	parts = append(parts, strings.TrimSpace(c.inlines(inline)))
+
+	var lines []string
+	for _, part := range parts {
+		if part != "" {
+			lines = append(lines, part)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *Converter) taskList(n *node) string {
+	var items []string
+	for _, task := range n.children {
+		if task.name != "ac:task" {
+			continue
+		}
+		marker := "- [ ] "
+		if status := task.child("ac:task-status"); status != nil && strings.TrimSpace(status.textContent()) == "complete" {
+			marker = "- [x] "
+		}
+		var body string
+		if b := task.child("ac:task-body"); b != nil {
+			body = c.listItem(b.children)
+		}
+		items = append(items, marker+indent(body, 2))
+	}
+	return strings.Join(items, "\n")
+}
+
+func (c *Converter) table(n *node) string {
+	var rows [][]string
+	var collect func(*node)
+	collect = func(n *node) {
+		for _, child := range n.children {
+			switch child.name {
+			case "thead", "tbody", "tfoot":
+				collect(child)
+			case "tr":
+				var row []string
+				for _, cell := range child.children {
+					if cell.name == "th" || cell.name == "td" {
+						text := strings.TrimSpace(whitespace.ReplaceAllString(c.inlines(cell.children), " "))
+						row = append(row, strings.Replace(text, "|", "\\|", -1))
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	collect(n)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	var lines []string
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// macro renders the code, panel and math macros as their markdown equivalents.
+// Other macros without a body become CONFLUENCE-MACRO code blocks, macros
+// with a body are replaced by their body.
+func (c *Converter) macro(n *node) string {
+	name := n.attr("ac:name")
+	var paramNames []string
+	params := make(map[string]string)
+	for _, p := range n.children {
+		if p.name == "ac:parameter" {
+			paramNames = append(paramNames, p.attr("ac:name"))
+			params[p.attr("ac:name")] = strings.TrimSpace(p.textContent())
+		}
+	}
+
+	if name == "code" || name == "noformat" {
+		var body string
+		if b := n.child("ac:plain-text-body"); b != nil {
+			body = b.textContent()
+		}
+		// Code blocks published by this tool are padded with a space
+		body = strings.TrimSuffix(strings.TrimPrefix(body, " "), " ")
+		return fence(body, params["language"])
+	}
+
+	if alert, ok := alertTypes[name]; ok {
+		header := "[!" + alert + "]"
+		if title := params["title"]; title != "" {
+			header = header + " " + title
+		}
+		var body string
+		if b := n.child("ac:rich-text-body"); b != nil {
+			body = c.blocks(b.children)
+		}
+		return quote(strings.TrimSpace(header + "\n" + body))
+	}
+
+	if formula, ok := mathFormula(n); ok {
+		return "$$\n" + formula + "\n$$"
+	}
+
+	if name == "toc" && !c.Toc {
+		plain := true
+		for _, p := range paramNames {
+			plain = plain && tocParams[p]
+		}
+		if plain {
+			c.Toc = true
+			c.TocParams = params
+			return ""
+		}
+	}
+
+	if b := n.child("ac:rich-text-body"); b != nil {
+		c.warn("macro %s was replaced by its content", name)
+		return c.blocks(b.children)
+	}
+	if n.child("ac:plain-text-body") != nil {
+		c.warn("macro %s was replaced by its content", name)
+		return fence(n.child("ac:plain-text-body").textContent(), "")
+	}
+
+	lines := []string{"name:" + name}
+	if v := n.attr("ac:schema-version"); v != "" {
+		lines = append(lines, "schema-version:"+v)
+	}
+	for _, p := range paramNames {
+		if p == "" {
+			lines = append(lines, "  "+params[p])
+		} else {
+			lines = append(lines, "  "+p+":"+params[p])
+		}
+	}
+	return fence(strings.Join(lines, "\n"), "CONFLUENCE-MACRO")
+}
+
+// mathFormula returns the formula of a mathinline, mathblock or latex macro
+func mathFormula(n *node) (string, bool) {
+	var formula string
+	switch n.attr("ac:name") {
+	case "mathinline":
+		for _, p := range n.children {
+			if p.name == "ac:parameter" && p.attr("ac:name") == "body" {
+				formula = p.textContent()
+			}
+		}
+	case "mathblock", "latex":
+		if b := n.child("ac:plain-text-body"); b != nil {
+			formula = b.textContent()
+		}
+	default:
+		return "", false
+	}
+	formula = strings.TrimSpace(formula)
+	if n.attr("ac:name") == "latex" {
+		formula = strings.Trim(formula, "$")
+	}
+	return strings.TrimSpace(formula), formula != ""
+}
+
+func (c *Converter) image(n *node) string {
+	alt := escape(n.attr("ac:alt"))
+	if a := n.child("ri:attachment"); a != nil {
+		return "![" + alt + "](" + destination(c.attachment(a.attr("ri:filename"))) + ")"
+	}
+	if u := n.child("ri:url"); u != nil {
+		return "![" + alt + "](" + destination(u.attr("ri:value")) + ")"
+	}
+	return ""
+}
+
+// attachment returns the path of the attachment with the given file name
+func (c *Converter) attachment(name string) string {
+	if c.Attachments == "" {
+		return name
+	}
+	return c.Attachments + "/" + name
+}
+
+func (c *Converter) link(n *node) string {
+	var text string
+	if b := n.child("ac:link-body"); b != nil {
+		text = c.inlines(b.children)
+	} else if b := n.child("ac:plain-text-link-body"); b != nil {
+		text = escape(b.textContent())
+	}
+
+	var target string
+	anchor := n.attr("ac:anchor")
+	if page := n.child("ri:page"); page != nil {
+		title := page.attr("ri:content-title")
+		if text == "" {
+			text = escape(title)
+		}
+		if c.Resolve != nil {
+			target = c.Resolve(title, page.attr("ri:space-key"))
+		}
+	} else if a := n.child("ri:attachment"); a != nil {
+		target = c.attachment(a.attr("ri:filename"))
+		if text == "" {
+			text = escape(a.attr("ri:filename"))
+		}
+	} else if u := n.child("ri:user"); u != nil {
+		if text == "" {
+			text = "@" + u.attr("ri:username")
+		}
+		return text
+	}
+
+	if anchor != "" {
+		target = target + "#" + anchor
+	}
+	if target == "" {
+		return text
+	}
+	return "[" + text + "](" + destination(target) + ")"
+}
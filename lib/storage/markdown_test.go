@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+
+	e "markdownToConfluence/lib/extension"
+	r "markdownToConfluence/lib/renderer"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name        string
+		storage     string
+		attachments string
+		markdown    string
+	}{
+		{
+			name:     "heading and paragraph",
+			storage:  "<h2>Title</h2><p>Some <strong>bold</strong> and <em>italic</em> text</p>",
+			markdown: "## Title\n\nSome **bold** and *italic* text\n",
+		},
+		{
+			name:     "markdown characters are escaped",
+			storage:  "<p>a *star*, [brackets] and snake_case</p>",
+			markdown: "a \\*star\\*, \\[brackets\\] and snake_case\n",
+		},
+		{
+			name:     "text that would start another block",
+			storage:  "<p># not a heading</p>",
+			markdown: "\\# not a heading\n",
+		},
+		{
+			name:     "code macro",
+			storage:  "<ac:structured-macro ac:name=\"code\"><ac:parameter ac:name=\"language\">go</ac:parameter><ac:plain-text-body><![CDATA[ fmt.Println(\"```\") ]]></ac:plain-text-body></ac:structured-macro>",
+			markdown: "````go\nfmt.Println(\"```\")\n````\n",
+		},
+		{
+			name:     "panel becomes an alert",
+			storage:  `<ac:structured-macro ac:name="warning"><ac:parameter ac:name="title">Careful</ac:parameter><ac:rich-text-body><p>body</p></ac:rich-text-body></ac:structured-macro>`,
+			markdown: "> [!WARNING] Careful\n> body\n",
+		},
+		{
+			name:     "task list",
+			storage:  `<ac:task-list><ac:task><ac:task-status>complete</ac:task-status><ac:task-body>done</ac:task-body></ac:task><ac:task><ac:task-status>incomplete</ac:task-status><ac:task-body>todo</ac:task-body></ac:task></ac:task-list>`,
+			markdown: "- [x] done\n- [ ] todo\n",
+		},
+		{
+			name:     "nested lists",
+			storage:  "<ol start=\"3\"><li>three<ul><li>nested</li></ul></li><li>four</li></ol>",
+			markdown: "3. three\n   - nested\n4. four\n",
+		},
+		{
+			name:     "table",
+			storage:  "<table><tbody><tr><th>a</th><th>b</th></tr><tr><td>1|2</td></tr></tbody></table>",
+			markdown: "| a | b |\n| --- | --- |\n| 1\\|2 |  |\n",
+		},
+		{
+			name:     "math macros",
+			storage:  `<p>Inline <ac:structured-macro ac:name="mathinline"><ac:parameter ac:name="body">x^2</ac:parameter></ac:structured-macro></p><ac:structured-macro ac:name="mathblock"><ac:plain-text-body><![CDATA[a+b]]></ac:plain-text-body></ac:structured-macro>`,
+			markdown: "Inline $x^2$\n\n$$\na+b\n$$\n",
+		},
+		{
+			name:     "image attachment",
+			storage:  `<p><ac:image ac:alt="diagram"><ri:attachment ri:filename="image.png"/></ac:image></p>`,
+			markdown: "![diagram](image.png)\n",
+		},
+		{
+			name:        "attachments in their own directory",
+			storage:     `<p><ac:image><ri:attachment ri:filename="my image.png"/></ac:image> <ac:link><ri:attachment ri:filename="spec.pdf"/></ac:link></p>`,
+			attachments: "Page.assets",
+			markdown:    "![](<Page.assets/my image.png>) [spec.pdf](Page.assets/spec.pdf)\n",
+		},
+		{
+			name:     "link to a page",
+			storage:  `<p><ac:link ac:anchor="usage"><ri:page ri:content-title="Other Page"/><ac:plain-text-link-body><![CDATA[see here]]></ac:plain-text-link-body></ac:link></p>`,
+			markdown: "[see here](<Other Page.md#usage>)\n",
+		},
+		{
+			name:     "unknown macro",
+			storage:  `<ac:structured-macro ac:name="jira" ac:schema-version="1"><ac:parameter ac:name="key">ABC-1</ac:parameter></ac:structured-macro>`,
+			markdown: "```CONFLUENCE-MACRO\nname:jira\nschema-version:1\n  key:ABC-1\n```\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Converter{
+				Attachments: tt.attachments,
+				Resolve: func(title, space string) string {
+					return title + ".md"
+				},
+			}
+			markdown, err := c.Convert(tt.storage)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if markdown != tt.markdown {
+				t.Errorf("markdown = %q, want %q", markdown, tt.markdown)
+			}
+		})
+	}
+}
+
+func TestConvertToc(t *testing.T) {
+	c := Converter{}
+	markdown, err := c.Convert(`<ac:structured-macro ac:name="toc"><ac:parameter ac:name="maxLevel">3</ac:parameter></ac:structured-macro><p>text</p>`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if markdown != "text\n" {
+		t.Errorf("markdown = %q, want %q", markdown, "text\n")
+	}
+	if !c.Toc || c.TocParams["maxLevel"] != "3" {
+		t.Errorf("Toc = %v, TocParams = %v, want a table of contents with maxLevel 3", c.Toc, c.TocParams)
+	}
+}
+
+// TestRoundTrip publishes markdown the way an upload does and converts the
+// storage format back, which has to give the same markdown
+func TestRoundTrip(t *testing.T) {
+	tests := []string{
+		"# Title\n\nSome **bold**, *italic* and `code` text\n",
+		"- one\n- two\n  - nested\n",
+		"1. one\n2. two\n",
+		"- [x] done\n- [ ] todo\n",
+		"```go\nfunc main() {}\n```\n",
+		"> [!NOTE] Title\n> body\n",
+		"| a | b |\n| --- | --- |\n| 1 | 2 |\n",
+		"Inline $x^2$ math\n\n$$\na+b\n$$\n",
+		"[external](https://example.com)\n",
+	}
+
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			md := goldmark.New(goldmark.WithExtensions(
+				extension.GFM,
+				e.NewMathExtension(""),
+				e.NewConfluenceExtension("", nil, r.DiagramConfig{}, r.FlavorCloud),
+			))
+			var buf bytes.Buffer
+			if err := md.Convert([]byte(src), &buf); err != nil {
+				t.Fatal(err)
+			}
+
+			c := Converter{}
+			markdown, err := c.Convert(buf.String())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if markdown != src {
+				t.Errorf("markdown = %q, want %q\nstorage format: %s", markdown, src, buf.String())
+			}
+		})
+	}
+}
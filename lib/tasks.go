@@ -0,0 +1,35 @@
+package lib
+
+import (
+	"regexp"
+)
+
+// storageTask matches a task of a Confluence task list, capturing its ID and status
+var storageTask = regexp.MustCompile(`(<ac:task>\s*<ac:task-id>(\d+)</ac:task-id>\s*<ac:task-status>)(\w+)(</ac:task-status>)`)
+
+// keepTaskStatus copies the status of the tasks in remote to the tasks with
+// the same ID in content. Task IDs change with the task text and the check
+// state in the markdown, so tasks ticked in Confluence stay ticked until the
+// markdown of the task is edited.
+func keepTaskStatus(content, remote string) string {
+	statuses := make(map[string]string)
+	for _, match := range storageTask.FindAllStringSubmatch(remote, -1) {
+		statuses[match[2]] = match[3]
+	}
+	if len(statuses) == 0 {
+		return content
+	}
+
+	return storageTask.ReplaceAllStringFunc(content, func(task string) string {
+		match := storageTask.FindStringSubmatch(task)
+		if status, ok := statuses[match[2]]; ok {
+			return match[1] + status + match[4]
+		}
+		return task
+	})
+}
+
+// withoutTaskStatus removes the task states from a storage format body
+func withoutTaskStatus(s string) string {
+	return storageTask.ReplaceAllString(s, "$1$4")
+}
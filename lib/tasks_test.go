@@ -0,0 +1,62 @@
+package lib
+
+import "testing"
+
+func TestKeepTaskStatus(t *testing.T) {
+	task := func(id, status, body string) string {
+		return "<ac:task>\n<ac:task-id>" + id + "</ac:task-id>\n<ac:task-status>" + status + "</ac:task-status>\n<ac:task-body>" + body + "</ac:task-body>\n</ac:task>\n"
+	}
+	list := func(tasks ...string) string {
+		s := "<ac:task-list>\n"
+		for _, t := range tasks {
+			s += t
+		}
+		return s + "</ac:task-list>\n"
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		remote  string
+		want    string
+	}{
+		{
+			name:    "no remote tasks",
+			content: list(task("1", "incomplete", "a")),
+			remote:  "<p>text</p>",
+			want:    list(task("1", "incomplete", "a")),
+		},
+		{
+			name:    "ticked in Confluence",
+			content: list(task("1", "incomplete", "a"), task("2", "incomplete", "b")),
+			remote:  list(task("2", "complete", "b"), task("1", "incomplete", "a")),
+			want:    list(task("1", "incomplete", "a"), task("2", "complete", "b")),
+		},
+		{
+			name:    "unticked in Confluence",
+			content: list(task("1", "complete", "a")),
+			remote:  list(task("1", "incomplete", "a")),
+			want:    list(task("1", "incomplete", "a")),
+		},
+		{
+			name:    "new and edited tasks keep the markdown status",
+			content: list(task("3", "incomplete", "c"), task("4", "complete", "a, edited")),
+			remote:  list(task("1", "incomplete", "a"), task("2", "complete", "b")),
+			want:    list(task("3", "incomplete", "c"), task("4", "complete", "a, edited")),
+		},
+		{
+			name:    "remote without whitespace between tags",
+			content: list(task("1", "incomplete", "a")),
+			remote:  "<ac:task-list><ac:task><ac:task-id>1</ac:task-id><ac:task-status>complete</ac:task-status><ac:task-body>a</ac:task-body></ac:task></ac:task-list>",
+			want:    list(task("1", "complete", "a")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keepTaskStatus(tt.content, tt.remote); got != tt.want {
+				t.Errorf("keepTaskStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Positions of the table of contents on a page
+const (
+	TocTop    = "top"
+	TocBottom = "bottom"
+)
+
+// TocConfig configures the table of contents macro added to a page. It is
+// set for all pages in .confluence.json and per page in the front matter,
+// either as `toc: true` or with the settings below.
+type TocConfig struct {
+	Enabled  bool   `yaml:"enabled" json:"enabled"`
+	Position string `yaml:"position,omitempty" json:"position,omitempty"`
+	MinLevel int    `yaml:"minLevel,omitempty" json:"minLevel,omitempty"`
+	MaxLevel int    `yaml:"maxLevel,omitempty" json:"maxLevel,omitempty"`
+	Style    string `yaml:"style,omitempty" json:"style,omitempty"`
+}
+
+// tocSettings has the layout of TocConfig, without its methods
+type tocSettings TocConfig
+
+// UnmarshalYAML accepts a boolean as well as the settings. Giving settings
+// enables the table of contents unless they say `enabled: false`.
+func (t *TocConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var enabled bool
+	if err := unmarshal(&enabled); err == nil {
+		*t = TocConfig{Enabled: enabled}
+		return nil
+	}
+	settings := tocSettings{Enabled: true}
+	if err := unmarshal(&settings); err != nil {
+		return err
+	}
+	*t = TocConfig(settings)
+	return nil
+}
+
+// UnmarshalJSON accepts the same forms as UnmarshalYAML, for .confluence.json
+func (t *TocConfig) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*t = TocConfig{Enabled: enabled}
+		return nil
+	}
+	settings := tocSettings{Enabled: true}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return err
+	}
+	*t = TocConfig(settings)
+	return nil
+}
+
+// MarshalYAML writes `true` or `false` when there are no other settings
+func (t TocConfig) MarshalYAML() (interface{}, error) {
+	if t.Position == "" && t.MinLevel == 0 && t.MaxLevel == 0 && t.Style == "" {
+		return t.Enabled, nil
+	}
+	return tocSettings(t), nil
+}
+
+// validate checks the position and levels of t
+func (t TocConfig) validate() error {
+	switch t.Position {
+	case "", TocTop, TocBottom:
+	default:
+		return fmt.Errorf("toc position must be %s or %s", TocTop, TocBottom)
+	}
+	if t.MinLevel < 0 || t.MinLevel > 6 || t.MaxLevel < 0 || t.MaxLevel > 6 {
+		return fmt.Errorf("toc levels must be between 1 and 6")
+	}
+	if t.MinLevel > 0 && t.MaxLevel > 0 && t.MinLevel > t.MaxLevel {
+		return fmt.Errorf("toc minLevel must not be greater than maxLevel")
+	}
+	return nil
+}
+
+// macro returns the toc macro in storage format
+func (t TocConfig) macro() string {
+	var sb strings.Builder
+	sb.WriteString(`<ac:structured-macro ac:name="toc" ac:schema-version="1">`)
+	if t.MinLevel > 0 {
+		sb.WriteString(`<ac:parameter ac:name="minLevel">` + strconv.Itoa(t.MinLevel) + `</ac:parameter>`)
+	}
+	if t.MaxLevel > 0 {
+		sb.WriteString(`<ac:parameter ac:name="maxLevel">` + strconv.Itoa(t.MaxLevel) + `</ac:parameter>`)
+	}
+	if t.Style != "" {
+		sb.WriteString(`<ac:parameter ac:name="style">` + html.EscapeString(t.Style) + `</ac:parameter>`)
+	}
+	sb.WriteString(`</ac:structured-macro>`)
+	return sb.String()
+}
+
+// pageToc returns the table of contents settings of f: the front matter
+// overrides the settings of .confluence.json
+func (m *Markdown2Confluence) pageToc(f *MarkdownFile) TocConfig {
+	toc := m.Toc
+	if t := f.Meta.Toc; t != nil {
+		toc.Enabled = t.Enabled
+		if t.Position != "" {
+			toc.Position = t.Position
+		}
+		if t.MinLevel != 0 {
+			toc.MinLevel = t.MinLevel
+		}
+		if t.MaxLevel != 0 {
+			toc.MaxLevel = t.MaxLevel
+		}
+		if t.Style != "" {
+			toc.Style = t.Style
+		}
+	}
+	return toc
+}
+
+// decoratePage adds the header, the footer and the table of contents to
+// the rendered content of f
+func (m *Markdown2Confluence) decoratePage(f *MarkdownFile, content string) (string, error) {
+	toc := m.pageToc(f)
+	if toc.Enabled {
+		if err := toc.validate(); err != nil {
+			return "", fmt.Errorf("%s: %s", f.Path, err)
+		}
+		if toc.Position == TocBottom {
+			content = content + toc.macro()
+		} else {
+			content = toc.macro() + content
+		}
+	}
+	return m.Header + content + m.Footer, nil
+}
+
+// undecoratePage removes the header and footer from a pulled page body,
+// as long as they were not changed in Confluence
+func (m *Markdown2Confluence) undecoratePage(body string) string {
+	body = strings.TrimSpace(body)
+	if h := strings.TrimSpace(m.Header); h != "" {
+		body = strings.TrimPrefix(body, h)
+	}
+	if f := strings.TrimSpace(m.Footer); f != "" {
+		body = strings.TrimSuffix(body, f)
+	}
+	return body
+}
@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestTocConfigUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		yaml string
+		toc  TocConfig
+	}{
+		{
+			name: "enabled",
+			json: `{"Toc": true}`,
+			yaml: "toc: true",
+			toc:  TocConfig{Enabled: true},
+		},
+		{
+			name: "disabled",
+			json: `{"Toc": false}`,
+			yaml: "toc: false",
+			toc:  TocConfig{},
+		},
+		{
+			name: "settings imply enabled",
+			json: `{"Toc": {"position": "bottom", "maxLevel": 3}}`,
+			yaml: "toc:\n  position: bottom\n  maxLevel: 3",
+			toc:  TocConfig{Enabled: true, Position: TocBottom, MaxLevel: 3},
+		},
+		{
+			name: "settings that disable",
+			json: `{"Toc": {"enabled": false, "style": "none"}}`,
+			yaml: "toc:\n  enabled: false\n  style: none",
+			toc:  TocConfig{Style: "none"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var conf ConfluenceConfig
+			if err := json.Unmarshal([]byte(tt.json), &conf); err != nil {
+				t.Fatalf("unexpected JSON error: %s", err)
+			}
+			if conf.Toc == nil || !reflect.DeepEqual(*conf.Toc, tt.toc) {
+				t.Errorf("JSON toc = %+v, want %+v", conf.Toc, tt.toc)
+			}
+
+			var fm FrontMatter
+			if err := yaml.Unmarshal([]byte(tt.yaml), &fm); err != nil {
+				t.Fatalf("unexpected YAML error: %s", err)
+			}
+			if fm.Toc == nil || !reflect.DeepEqual(*fm.Toc, tt.toc) {
+				t.Errorf("YAML toc = %+v, want %+v", fm.Toc, tt.toc)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package lib
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultTimeout is how long a request may take, including reading the
+	// response, unless --timeout says otherwise
+	DefaultTimeout = 2 * time.Minute
+
+	// DefaultMaxRetries is how often a failed request is retried unless --max-retries says otherwise
+	DefaultMaxRetries = 5
+
+	// retryBaseDelay is the delay before the first retry, doubled for every further one
+	retryBaseDelay = 500 * time.Millisecond
+	// retryMaxDelay caps the exponential backoff
+	retryMaxDelay = 30 * time.Second
+	// retryAfterMax caps the delay a Retry-After header may ask for
+	retryAfterMax = 5 * time.Minute
+)
+
+// retryTransport is an http.RoundTripper that retries requests Confluence
+// rejected because of rate limits or failed to answer, with exponential
+// backoff and jitter, or after the delay given by the Retry-After header
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	// timeout limits every attempt, not the retries as a whole
+	timeout time.Duration
+	debug   bool
+	// sleep waits for d or until the request is cancelled
+	sleep func(req *http.Request, d time.Duration) error
+}
+
+// newRetryTransport returns a retryTransport on top of base
+func newRetryTransport(base http.RoundTripper, maxRetries int, timeout time.Duration, debug bool) *retryTransport {
+	return &retryTransport{
+		base:       base,
+		maxRetries: maxRetries,
+		timeout:    timeout,
+		debug:      debug,
+		sleep:      sleepRequest,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		try := req
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			try = new(http.Request)
+			*try = *req
+			try.Body = body
+		}
+
+		res, err := t.roundTrip(try)
+		if attempt >= t.maxRetries || !retryable(req, res, err) {
+			return res, err
+		}
+		// The body of a request that can not be rebuilt is consumed
+		if req.Body != nil && req.GetBody == nil {
+			return res, err
+		}
+
+		delay := backoff(attempt)
+		reason := fmt.Sprint(err)
+		if res != nil {
+			if d, ok := retryAfter(res); ok {
+				delay = d
+			}
+			reason = res.Status
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+		if t.debug {
+			fmt.Printf("%s %s: %s, retrying in %s\n", req.Method, req.URL, reason, delay)
+		}
+		if err := t.sleep(req, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// roundTrip sends req once, cancelling it when it takes longer than the timeout
+func (t *retryTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	res, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The timeout also covers reading the body
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// cancelBody releases the context of a request when its response is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// retryable reports whether a request that got res or err may succeed when
+// it is sent again. Requests that are not idempotent are only repeated
+// when Confluence turned them away before processing them.
+func retryable(req *http.Request, res *http.Response, err error) bool {
+	if err != nil {
+		return idempotent(req.Method) && req.Context().Err() == nil && !certificateError(err)
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(req.Method)
+	}
+	return false
+}
+
+// certificateError reports whether err is the TLS certificate of Confluence
+// failing verification, which does not go away by retrying
+func certificateError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	return errors.As(err, &unknownAuthority) || errors.As(err, &invalid) || errors.As(err, &hostname)
+}
+
+// idempotent reports whether requests of method may be repeated safely
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before retry number attempt+1: the exponential
+// delay with full jitter in its upper half, so that parallel workers that
+// failed together do not retry together
+func backoff(attempt int) time.Duration {
+	d := retryMaxDelay
+	if attempt < 16 {
+		if exp := retryBaseDelay << uint(attempt); exp < retryMaxDelay {
+			d = exp
+		}
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter returns the delay asked for by the Retry-After header of res,
+// given in seconds or as an HTTP date
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	var d time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		d = time.Until(date)
+	} else {
+		return 0, false
+	}
+	if d < 0 {
+		d = 0
+	}
+	if d > retryAfterMax {
+		d = retryAfterMax
+	}
+	return d, true
+}
+
+// sleepRequest waits for d, or returns early when req is cancelled
+func sleepRequest(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// newHTTPClient returns the HTTP client all requests to Confluence are sent
+// with: through the proxy, trusting the CA certificates and presenting the
+// client certificate that are configured, and retrying failed requests
+func (m *Markdown2Confluence) newHTTPClient() (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if m.Proxy != "" {
+		u, err := url.Parse(m.Proxy)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("--proxy %s is not a URL such as http://proxy.example.com:3128", m.Proxy)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: m.InsecureSkipVerify}
+	if len(m.CACerts) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		for _, file := range m.CACerts {
+			pem, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("Error reading CA certificates %s: %s", file, err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("%s contains no PEM encoded CA certificates", file)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if m.ClientCert != "" || m.ClientKey != "" {
+		if m.ClientCert == "" || m.ClientKey == "" {
+			return nil, fmt.Errorf("--client-cert and --client-key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(m.ClientCert, m.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading client certificate %s: %s", m.ClientCert, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if m.InsecureSkipVerify {
+		fmt.Println("warning: --insecure-skip-verify is set, the certificate of Confluence is not verified")
+	}
+
+	base := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   Parallelism * 2,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{Transport: newRetryTransport(base, m.MaxRetries, m.Timeout, m.Debug)}, nil
+}
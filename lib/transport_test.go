@@ -0,0 +1,214 @@
+package lib
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc is an http.RoundTripper answering with a function
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRetryTransport(t *testing.T) {
+	errConnection := errors.New("connection reset")
+
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		answers  []interface{}
+		status   int
+		attempts int
+		delays   []time.Duration
+		err      bool
+	}{
+		{
+			name:     "success",
+			method:   http.MethodGet,
+			answers:  []interface{}{200},
+			status:   200,
+			attempts: 1,
+		},
+		{
+			name:     "rate limit with Retry-After seconds",
+			method:   http.MethodGet,
+			answers:  []interface{}{"429 7", 200},
+			status:   200,
+			attempts: 2,
+			delays:   []time.Duration{7 * time.Second},
+		},
+		{
+			name:     "Retry-After is capped",
+			method:   http.MethodGet,
+			answers:  []interface{}{"429 3600", 200},
+			status:   200,
+			attempts: 2,
+			delays:   []time.Duration{retryAfterMax},
+		},
+		{
+			name:     "rate limited POST is retried with its body",
+			method:   http.MethodPost,
+			body:     "content",
+			answers:  []interface{}{429, 200},
+			status:   200,
+			attempts: 2,
+		},
+		{
+			name:     "unavailable GET is retried",
+			method:   http.MethodGet,
+			answers:  []interface{}{503, 502, 200},
+			status:   200,
+			attempts: 3,
+		},
+		{
+			name:     "unavailable POST is not retried",
+			method:   http.MethodPost,
+			body:     "content",
+			answers:  []interface{}{503},
+			status:   503,
+			attempts: 1,
+		},
+		{
+			name:     "connection error of a PUT is retried",
+			method:   http.MethodPut,
+			body:     "content",
+			answers:  []interface{}{errConnection, 200},
+			status:   200,
+			attempts: 2,
+		},
+		{
+			name:     "connection error of a POST is not retried",
+			method:   http.MethodPost,
+			body:     "content",
+			answers:  []interface{}{errConnection},
+			attempts: 1,
+			err:      true,
+		},
+		{
+			name:     "client errors are not retried",
+			method:   http.MethodGet,
+			answers:  []interface{}{404},
+			status:   404,
+			attempts: 1,
+		},
+		{
+			name:     "retries are limited",
+			method:   http.MethodGet,
+			answers:  []interface{}{503, 503, 503, 503},
+			status:   503,
+			attempts: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+			var bodies []string
+			base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				answer := tt.answers[attempts]
+				attempts++
+				if req.Body != nil {
+					b, _ := ioutil.ReadAll(req.Body)
+					bodies = append(bodies, string(b))
+				}
+				res := &http.Response{Header: make(http.Header), Body: ioutil.NopCloser(strings.NewReader(""))}
+				switch a := answer.(type) {
+				case error:
+					return nil, a
+				case int:
+					res.StatusCode = a
+				case string:
+					// "<status> <Retry-After>"
+					fields := strings.Fields(a)
+					res.StatusCode, _ = strconv.Atoi(fields[0])
+					res.Header.Set("Retry-After", fields[1])
+				}
+				res.Status = http.StatusText(res.StatusCode)
+				return res, nil
+			})
+
+			var delays []time.Duration
+			transport := newRetryTransport(base, 2, 0, false)
+			transport.sleep = func(req *http.Request, d time.Duration) error {
+				delays = append(delays, d)
+				return nil
+			}
+
+			req, _ := http.NewRequest(tt.method, "https://example.com/rest/api/content", nil)
+			if tt.body != "" {
+				req, _ = http.NewRequest(tt.method, "https://example.com/rest/api/content", strings.NewReader(tt.body))
+			}
+
+			res, err := transport.RoundTrip(req)
+			if tt.err != (err != nil) {
+				t.Fatalf("err = %v, want an error: %v", err, tt.err)
+			}
+			if res != nil && res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.attempts)
+			}
+			if len(delays) != tt.attempts-1 {
+				t.Errorf("waited %d times, want %d", len(delays), tt.attempts-1)
+			}
+			for i, d := range tt.delays {
+				if delays[i] != d {
+					t.Errorf("delay %d = %s, want %s", i, delays[i], d)
+				}
+			}
+			for _, b := range bodies {
+				if b != tt.body {
+					t.Errorf("body = %q, want %q", b, tt.body)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < 20; attempt++ {
+		max := retryMaxDelay
+		if attempt < 6 {
+			max = retryBaseDelay << uint(attempt)
+		}
+		d := backoff(attempt)
+		if d < max/2 || d > max {
+			t.Errorf("backoff(%d) = %s, want between %s and %s", attempt, d, max/2, max)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{value: ""},
+		{value: "soon"},
+		{value: "0", ok: true},
+		{value: "-5", ok: true},
+		{value: "120", delay: 2 * time.Minute, ok: true},
+		{value: "86400", delay: retryAfterMax, ok: true},
+		{value: "Mon, 02 Jan 2006 15:04:05 GMT", ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			res := &http.Response{Header: http.Header{"Retry-After": []string{tt.value}}}
+			delay, ok := retryAfter(res)
+			if ok != tt.ok || delay != tt.delay {
+				t.Errorf("retryAfter(%q) = %s, %v, want %s, %v", tt.value, delay, ok, tt.delay, tt.ok)
+			}
+		})
+	}
+}
@@ -5,9 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"regexp"
 	"sort"
-	"strconv"
 )
 
 // RunGitCommand 执行任意Git命令的封装
@@ -32,21 +30,6 @@ func RunGitCommand(name string, arg ...string) string {
 	return stdout.String()
 }
 
-// ConvertOctonaryUtf8 转换8进制utf-8字符串到中文 eg: `\346\200\241` -> 怡
-func ConvertOctonaryUtf8(in string) string {
-	s := []byte(in)
-	reg := regexp.MustCompile(`\\[0-7]{3}`)
-
-	out := reg.ReplaceAllFunc(
-		s,
-		func(b []byte) []byte {
-			i, _ := strconv.ParseInt(string(b[1:]), 8, 0)
-			return []byte{byte(i)}
-		},
-	)
-	return string(out)
-}
-
 func ReadDirNames(dirname string) ([]string, error) {
 	f, err := os.Open(dirname)
 	if err != nil {